@@ -0,0 +1,258 @@
+// Локальный OpenID Connect провайдер для проверки входа через OIDC без внешних сервисов.
+//
+// Запуск:
+//
+//	go run ./cmd/mockoidc
+//
+// Настройки сервера для работы с ним:
+//
+//	OIDC_PROVIDERS=mock
+//	OIDC_MOCK_ISSUER=http://127.0.0.1:9000
+//	OIDC_MOCK_CLIENT_ID=mango
+//
+// Страница авторизации позволяет указать sub, email и признак подтверждения email,
+// чтобы проверить регистрацию, повторный вход и привязку к существующему аккаунту.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"log"
+	"mango/internal/oidc"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const keyID = "mock"
+
+type authorization struct {
+	ClientID      string
+	RedirectURI   string
+	CodeChallenge string
+	Nonce         string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	ExpiresAt     time.Time
+}
+
+type server struct {
+	issuer   string
+	clientID string
+	key      *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+var authorizePage = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head><meta charset="utf-8"><title>Mock OIDC</title></head>
+<body>
+<h1>Вход через Mock OIDC</h1>
+<form method="post" action="/authorize">
+    {{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{index $value 0}}">
+    {{end}}
+    <p><label>sub <input name="sub" value="mock-user-1" required></label></p>
+    <p><label>email <input name="email" type="email" value="mock@example.com"></label></p>
+    <p><label><input name="email_verified" type="checkbox" value="true" checked> email подтвержден</label></p>
+    <p><label>name <input name="name" value="Mock User"></label></p>
+    <p><button type="submit">Разрешить</button> <button type="submit" name="deny" value="1">Отклонить</button></p>
+</form>
+</body>
+</html>`))
+
+func main() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalf("Ошибка генерации ключа: %v", err)
+	}
+
+	s := &server{
+		issuer:   getEnv("MOCK_OIDC_ISSUER", "http://127.0.0.1:9000"),
+		clientID: getEnv("MOCK_OIDC_CLIENT_ID", "mango"),
+		key:      key,
+		codes:    make(map[string]authorization),
+	}
+
+	http.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	http.HandleFunc("/authorize", s.authorize)
+	http.HandleFunc("/token", s.token)
+	http.HandleFunc("/jwks", s.jwks)
+
+	addr := getEnv("MOCK_OIDC_ADDR", ":9000")
+	log.Printf("Mock OIDC провайдер %s слушает %s", s.issuer, addr)
+	log.Fatal(http.ListenAndServe(addr, nil))
+}
+
+func (s *server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.issuer,
+		"authorization_endpoint":                s.issuer + "/authorize",
+		"token_endpoint":                        s.issuer + "/token",
+		"jwks_uri":                              s.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (s *server) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	redirectURI := r.Form.Get("redirect_uri")
+	if r.Form.Get("client_id") != s.clientID || redirectURI == "" {
+		http.Error(w, "неизвестный client_id или пустой redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if r.Form.Get("response_type") != "code" || r.Form.Get("code_challenge_method") != "S256" || r.Form.Get("code_challenge") == "" {
+		http.Error(w, "требуется response_type=code и PKCE S256", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		authorizePage.Execute(w, map[string]interface{}{"Params": r.URL.Query()})
+		return
+	}
+
+	params := url.Values{}
+	params.Set("state", r.Form.Get("state"))
+
+	if r.PostForm.Get("deny") != "" {
+		params.Set("error", "access_denied")
+		http.Redirect(w, r, redirectURI+"?"+params.Encode(), http.StatusFound)
+		return
+	}
+
+	code := randomString(16)
+	s.mu.Lock()
+	s.codes[code] = authorization{
+		ClientID:      s.clientID,
+		RedirectURI:   redirectURI,
+		CodeChallenge: r.Form.Get("code_challenge"),
+		Nonce:         r.Form.Get("nonce"),
+		Subject:       r.PostForm.Get("sub"),
+		Email:         r.PostForm.Get("email"),
+		EmailVerified: r.PostForm.Get("email_verified") == "true",
+		Name:          r.PostForm.Get("name"),
+		ExpiresAt:     time.Now().Add(time.Minute),
+	}
+	s.mu.Unlock()
+
+	params.Set("code", code)
+	http.Redirect(w, r, redirectURI+"?"+params.Encode(), http.StatusFound)
+}
+
+func (s *server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request", err.Error())
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type", "")
+		return
+	}
+
+	s.mu.Lock()
+	auth, ok := s.codes[r.PostForm.Get("code")]
+	delete(s.codes, r.PostForm.Get("code"))
+	s.mu.Unlock()
+
+	switch {
+	case !ok || time.Now().After(auth.ExpiresAt):
+		tokenError(w, "invalid_grant", "код недействителен")
+		return
+	case r.PostForm.Get("client_id") != auth.ClientID || r.PostForm.Get("redirect_uri") != auth.RedirectURI:
+		tokenError(w, "invalid_grant", "client_id или redirect_uri не совпадают")
+		return
+	case oidc.CodeChallenge(r.PostForm.Get("code_verifier")) != auth.CodeChallenge:
+		tokenError(w, "invalid_grant", "code_verifier не прошел проверку PKCE")
+		return
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            s.issuer,
+		"aud":            auth.ClientID,
+		"sub":            auth.Subject,
+		"email":          auth.Email,
+		"email_verified": auth.EmailVerified,
+		"name":           auth.Name,
+		"nonce":          auth.Nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	})
+	token.Header["kid"] = keyID
+
+	idToken, err := token.SignedString(s.key)
+	if err != nil {
+		tokenError(w, "server_error", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(16),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (s *server) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := s.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func tokenError(w http.ResponseWriter, code, description string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code, "error_description": description})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
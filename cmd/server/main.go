@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
 	"log"
+	"mango/internal/accounts"
+	"mango/internal/auth"
+	"mango/internal/avatar"
 	"mango/internal/config"
 	"mango/internal/handlers"
+	"mango/internal/mailer"
 	"mango/internal/middleware"
 	"mango/internal/models"
+	"path/filepath"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,13 +23,30 @@ func main() {
 		log.Fatalf("Ошибка подключения к БД: %v", err)
 	}
 
+	keys, err := config.LoadJWTKeys()
+	if err != nil {
+		log.Fatalf("Ошибка загрузки ключей JWT: %v", err)
+	}
+	auth.Keys = keys
+
+	passwords, err := config.LoadPasswordHasher()
+	if err != nil {
+		log.Fatalf("Ошибка настройки хеширования паролей: %v", err)
+	}
+	auth.Passwords = passwords
+
 	r := gin.Default()
 
+	// IP клиента используется для ограничения попыток входа, сессий и журнала имперсонации
+	if err := r.SetTrustedProxies(config.TrustedProxies()); err != nil {
+		log.Fatalf("Ошибка настройки TRUSTED_PROXIES: %v", err)
+	}
+
 	// Ручная настройка CORS
 	r.Use(func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -32,47 +56,201 @@ func main() {
 		c.Next()
 	})
 
+	// Очередь исходящих писем
+	mail, err := config.LoadMailer()
+	if err != nil {
+		log.Fatalf("Ошибка настройки почты: %v", err)
+	}
+	outbox := &mailer.Outbox{DB: db, Mailer: mail, Interval: 10 * time.Second, BatchSize: 20, MaxAttempts: 5}
+	go outbox.Run(context.Background())
+
+	// Кеш состояний пользователей для проверки токенов
+	states := auth.NewUserStates(db, 30*time.Second)
+
+	// Аватары пользователей
+	avatars := &avatar.Store{Dir: filepath.Join(config.UploadDir(), "avatars")}
+	r.Static(avatar.URLPrefix, avatars.Dir)
+
+	// Обезличивание аккаунтов после периода ожидания или срока хранения удаленных
+	deletionGrace, err := config.AccountDeletionGrace()
+	if err != nil {
+		log.Fatalf("Ошибка настройки удаления аккаунтов: %v", err)
+	}
+	retention, err := config.DeletedUserRetention()
+	if err != nil {
+		log.Fatalf("Ошибка настройки удаления аккаунтов: %v", err)
+	}
+	purger := &accounts.Purger{DB: db, States: states, Avatars: avatars, Interval: time.Hour, BatchSize: 50, Retention: retention}
+	go purger.Run(context.Background())
+
+	// Ограничение подбора паролей
+	throttle := &auth.LoginThrottle{
+		DB:            db,
+		Username:      auth.ThrottleLimits{FreeAttempts: 5, LockoutAttempts: 10, LockoutDuration: 15 * time.Minute},
+		IP:            auth.ThrottleLimits{FreeAttempts: 20, LockoutAttempts: 100, LockoutDuration: time.Hour},
+		BaseDelay:     time.Second,
+		MaxDelay:      5 * time.Minute,
+		Window:        15 * time.Minute,
+		PruneInterval: time.Hour,
+	}
+	go throttle.Run(context.Background())
+
+	// Провайдеры входа через OpenID Connect
+	oidcProviders, err := config.LoadOIDCProviders()
+	if err != nil {
+		log.Fatalf("Ошибка настройки OIDC: %v", err)
+	}
+
+	passwordPolicy, err := config.LoadPasswordPolicy()
+	if err != nil {
+		log.Fatalf("Ошибка настройки политики паролей: %v", err)
+	}
+
+	inviteOnly, err := config.InviteOnly()
+	if err != nil {
+		log.Fatalf("Ошибка настройки регистрации: %v", err)
+	}
+
+	emailPolicy, err := config.EmailPolicy()
+	if err != nil {
+		log.Fatalf("Ошибка настройки подтверждения email: %v", err)
+	}
+
 	// Обработчики
-	userHandler := handlers.UserHandler{DB: db}
+	userHandler := handlers.UserHandler{
+		DB:              db,
+		States:          states,
+		AppURL:          config.AppURL(),
+		EmailPolicy:     emailPolicy,
+		TwoFactorPolicy: config.TwoFactorPolicy(),
+		Throttle:        throttle,
+		OIDC:            oidcProviders,
+		PasswordPolicy:  passwordPolicy,
+		DeletionGrace:   deletionGrace,
+		InviteOnly:      inviteOnly,
+		Avatars:         avatars,
+	}
 	mangaHandler := handlers.MangaHandler{DB: db}
+	roleHandler := handlers.RoleHandler{DB: db, States: states}
+	impersonationHandler := handlers.ImpersonationHandler{DB: db, States: states}
+	apiKeyHandler := handlers.APIKeyHandler{DB: db, States: states}
+	invitationHandler := handlers.InvitationHandler{DB: db, States: states, AppURL: userHandler.AppURL}
 
 	// Публичные маршруты
 	r.POST("/api/register", userHandler.Register)
+	r.POST("/api/register/invite", userHandler.AcceptInvitation)
 	r.POST("/api/login", userHandler.Login)
+	r.POST("/api/login/2fa", userHandler.LoginTwoFactor)
+	r.POST("/api/refresh", userHandler.Refresh)
+	r.POST("/api/logout", userHandler.Logout)
+	r.POST("/api/password/forgot", userHandler.ForgotPassword)
+	r.POST("/api/password/reset", userHandler.ResetPassword)
+	r.POST("/api/verify-email", userHandler.VerifyEmail)
+	r.POST("/api/account/deletion/confirm", userHandler.ConfirmAccountDeletion)
+	r.GET("/api/oauth/providers", userHandler.GetOAuthProviders)
+	r.GET("/api/oauth/:provider/start", userHandler.OAuthStart)
+	r.GET("/api/oauth/:provider/callback", userHandler.OAuthCallback)
+	r.POST("/api/oauth/exchange", userHandler.OAuthExchange)
+	r.GET("/.well-known/jwks.json", handlers.JWKS)
 
 	// Публичные маршруты для манги (без авторизации)
 	r.GET("/api/manga", mangaHandler.GetAllManga)
+	r.GET("/api/manga/suggest", mangaHandler.SuggestManga)
 	r.GET("/api/manga/:id", mangaHandler.GetMangaByID)
 
+	// Публичные профили пользователей
+	r.GET("/api/users/:username", userHandler.GetPublicProfile)
+
 	// Маршруты для всех авторизованных пользователей
 	userRoutes := r.Group("/api/user")
-	userRoutes.Use(middleware.AuthRequired(models.RoleUser, models.RoleAdmin, models.RoleSuperAdmin))
+	userRoutes.Use(middleware.AuthRequired(states))
 	{
-		userRoutes.PUT("/profile", userHandler.ChangeProfile)
-		userRoutes.PUT("/password", userHandler.ChangePassword)
+		// Чувствительные действия недоступны при входе от имени пользователя
+		sensitive := middleware.InteractiveOnly()
+		userRoutes.PUT("/profile", sensitive, userHandler.ChangeProfile)
+		userRoutes.PUT("/password", sensitive, userHandler.ChangePassword)
+		userRoutes.POST("/email/resend", userHandler.ResendVerification)
+		userRoutes.POST("/2fa/setup", sensitive, userHandler.SetupTwoFactor)
+		userRoutes.POST("/2fa/enable", sensitive, userHandler.EnableTwoFactor)
+		userRoutes.POST("/2fa/disable", sensitive, userHandler.DisableTwoFactor)
+		userRoutes.POST("/2fa/recovery-codes", sensitive, userHandler.RegenerateRecoveryCodes)
+		userRoutes.GET("/sessions", userHandler.GetSessions)
+		userRoutes.DELETE("/sessions/:id", sensitive, userHandler.RevokeSession)
+		userRoutes.DELETE("/sessions", sensitive, userHandler.RevokeOtherSessions)
+		userRoutes.POST("/avatar", sensitive, userHandler.UploadAvatar)
+		userRoutes.DELETE("/avatar", sensitive, userHandler.DeleteAvatar)
+		userRoutes.GET("/export", sensitive, userHandler.ExportData)
+		userRoutes.POST("/deletion", sensitive, userHandler.DeleteAccount)
+		userRoutes.DELETE("/deletion", sensitive, userHandler.CancelAccountDeletion)
+
+		// Выход из режима входа от имени пользователя
+		userRoutes.DELETE("/impersonation", impersonationHandler.StopImpersonation)
 	}
 
-	// Маршруты для администраторов
+	// Административные маршруты, доступ определяется правами роли
 	adminRoutes := r.Group("/api/admin")
-	adminRoutes.Use(middleware.AuthRequired(models.RoleAdmin, models.RoleSuperAdmin))
+	// API-ключи принимаются только здесь: каждый маршрут группы проверяет scopes через PermissionRequired
+	adminRoutes.Use(middleware.AuthRequiredOrAPIKey(states))
+	adminRoutes.Use(middleware.RequireTwoFactor(states, userHandler.TwoFactorPolicy))
 	{
 		// Управление пользователями
-		adminRoutes.GET("/users", userHandler.GetUsers)
-		adminRoutes.PUT("/users/:id/block", userHandler.BlockUser)
-		adminRoutes.DELETE("/users/:id", userHandler.DeleteUser)
+		adminRoutes.GET("/users", middleware.PermissionRequired(states, models.PermissionUsersRead), userHandler.GetUsers)
+		adminRoutes.GET("/users/export", middleware.PermissionRequired(states, models.PermissionUsersRead), userHandler.ExportUsers)
+		adminRoutes.PUT("/users/:id/block", middleware.PermissionRequired(states, models.PermissionUsersBlock), userHandler.BlockUser)
+		adminRoutes.PUT("/users/:id/unblock", middleware.PermissionRequired(states, models.PermissionUsersBlock), userHandler.UnblockUser)
+		adminRoutes.DELETE("/users/:id", middleware.PermissionRequired(states, models.PermissionUsersDelete), userHandler.DeleteUser)
+		adminRoutes.PUT("/users/:id/restore", middleware.PermissionRequired(states, models.PermissionUsersDelete), userHandler.RestoreUser)
+		adminRoutes.POST("/users/bulk/block", middleware.PermissionRequired(states, models.PermissionUsersBlock), userHandler.BulkUsers("block"))
+		adminRoutes.POST("/users/bulk/unblock", middleware.PermissionRequired(states, models.PermissionUsersBlock), userHandler.BulkUsers("unblock"))
+		adminRoutes.POST("/users/bulk/delete", middleware.PermissionRequired(states, models.PermissionUsersDelete), userHandler.BulkUsers("delete"))
+		adminRoutes.POST("/users/bulk/restore", middleware.PermissionRequired(states, models.PermissionUsersDelete), userHandler.BulkUsers("restore"))
+		adminRoutes.GET("/lockouts", middleware.PermissionRequired(states, models.PermissionLockoutsManage), userHandler.GetLockouts)
+		adminRoutes.DELETE("/lockouts/:scope/:key", middleware.PermissionRequired(states, models.PermissionLockoutsManage), userHandler.ClearLockout)
+
+		// API-ключи для сервисных интеграций
+		apiKeysManage := middleware.PermissionRequired(states, models.PermissionAPIKeysManage)
+		adminRoutes.GET("/api-keys", apiKeysManage, apiKeyHandler.GetAPIKeys)
+		adminRoutes.POST("/api-keys", apiKeysManage, middleware.InteractiveOnly(), apiKeyHandler.CreateAPIKey)
+		adminRoutes.DELETE("/api-keys/:id", apiKeysManage, apiKeyHandler.RevokeAPIKey)
+
+		// Приглашения сотрудников
+		invitesManage := middleware.PermissionRequired(states, models.PermissionInvitesManage)
+		adminRoutes.GET("/invitations", invitesManage, invitationHandler.GetInvitations)
+		adminRoutes.POST("/invitations", invitesManage, middleware.InteractiveOnly(), invitationHandler.CreateInvitation)
+		adminRoutes.DELETE("/invitations/:id", invitesManage, invitationHandler.RevokeInvitation)
 
 		// Управление мангой
-		adminRoutes.GET("/manga", mangaHandler.GetAllMangaAdmin)
-		adminRoutes.POST("/manga", mangaHandler.CreateManga)
-		adminRoutes.PUT("/manga/:id", mangaHandler.UpdateManga)
-		adminRoutes.DELETE("/manga/:id", mangaHandler.DeleteManga)
+		mangaWrite := middleware.PermissionRequired(states, models.PermissionMangaWrite)
+		adminRoutes.GET("/manga", mangaWrite, mangaHandler.GetAllMangaAdmin)
+		adminRoutes.POST("/manga", mangaWrite, mangaHandler.CreateManga)
+		adminRoutes.PUT("/manga/:id", mangaWrite, mangaHandler.UpdateManga)
+		adminRoutes.DELETE("/manga/:id", mangaWrite, mangaHandler.DeleteManga)
+		adminRoutes.POST("/manga/bulk/activate", mangaWrite, mangaHandler.BulkManga("activate"))
+		adminRoutes.POST("/manga/bulk/deactivate", mangaWrite, mangaHandler.BulkManga("deactivate"))
 	}
 
 	// Маршруты только для суперадминов
 	superAdminRoutes := r.Group("/api/super")
-	superAdminRoutes.Use(middleware.AuthRequired(models.RoleSuperAdmin))
+	superAdminRoutes.Use(middleware.AuthRequired(states, models.RoleSuperAdmin))
+	superAdminRoutes.Use(middleware.RequireTwoFactor(states, userHandler.TwoFactorPolicy))
+	superAdminRoutes.Use(middleware.InteractiveOnly())
 	{
-		// Специальные маршруты для суперадмина
+		// Управление ролями и правами
+		superAdminRoutes.GET("/permissions", roleHandler.GetPermissions)
+		superAdminRoutes.GET("/roles", roleHandler.GetRoles)
+		superAdminRoutes.POST("/roles", roleHandler.CreateRole)
+		superAdminRoutes.PUT("/roles/:name", roleHandler.UpdateRole)
+		superAdminRoutes.DELETE("/roles/:name", roleHandler.DeleteRole)
+
+		// Назначение ролей пользователям
+		superAdminRoutes.PUT("/users/:id/role", roleHandler.ChangeUserRole)
+		superAdminRoutes.GET("/role-changes", roleHandler.GetRoleChanges)
+
+		// Вход от имени пользователя
+		superAdminRoutes.POST("/users/:id/impersonate", middleware.PermissionRequired(states, models.PermissionImpersonate), impersonationHandler.Impersonate)
+		superAdminRoutes.GET("/impersonations", impersonationHandler.GetImpersonationSessions)
+		superAdminRoutes.DELETE("/impersonations/:id", impersonationHandler.EndImpersonation)
+		superAdminRoutes.GET("/impersonation-log", impersonationHandler.GetImpersonationLog)
 	}
 
 	log.Println("Сервер запущен на порту 8080")
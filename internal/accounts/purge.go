@@ -0,0 +1,158 @@
+package accounts
+
+import (
+	"context"
+	"log"
+	"mango/internal/auth"
+	"mango/internal/avatar"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Purger обезличивает аккаунты, срок удаления которых наступил: по запросу
+// самого пользователя или через Retention после удаления администратором
+type Purger struct {
+	DB        *sqlx.DB
+	States    *auth.UserStates
+	Avatars   *avatar.Store
+	Interval  time.Duration
+	BatchSize int
+	Retention time.Duration
+}
+
+// Run периодически обрабатывает аккаунты до отмены контекста
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.purgeDue(); err != nil {
+			log.Printf("Ошибка удаления аккаунтов: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Purger) purgeDue() error {
+	var ids []int64
+	err := p.DB.Select(&ids,
+		`SELECT id FROM users
+         WHERE (deletion_scheduled_at <= NOW() OR deleted_at <= $1) AND anonymized_at IS NULL
+         ORDER BY id LIMIT $2`,
+		time.Now().Add(-p.Retention), p.BatchSize)
+	if err != nil {
+		return err
+	}
+
+	// Ошибка на одном аккаунте не должна задерживать обезличивание остальных
+	for _, id := range ids {
+		if err := p.purge(id); err != nil {
+			log.Printf("Ошибка обезличивания аккаунта пользователя %d: %v", id, err)
+			continue
+		}
+		log.Printf("Аккаунт пользователя %d обезличен", id)
+	}
+	return nil
+}
+
+func (p *Purger) purge(userID int64) error {
+	tx, err := p.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Повторная проверка под блокировкой: удаление могли отменить или пользователя восстановить
+	var due bool
+	err = tx.Get(&due,
+		"SELECT COALESCE(deletion_scheduled_at <= NOW() OR deleted_at <= $2, FALSE) AND anonymized_at IS NULL FROM users WHERE id = $1 FOR UPDATE",
+		userID, time.Now().Add(-p.Retention))
+	if err != nil || !due {
+		return err
+	}
+
+	var avatarURL *string
+	if err := tx.Get(&avatarURL, "SELECT avatar_url FROM users WHERE id = $1", userID); err != nil {
+		return err
+	}
+
+	if err := Anonymize(tx, userID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if avatarURL != nil {
+		if err := p.Avatars.Remove(*avatarURL); err != nil {
+			log.Printf("Ошибка удаления аватара пользователя %d: %v", userID, err)
+		}
+	}
+
+	p.States.Invalidate(userID)
+	return nil
+}
+
+// Anonymize удаляет персональные данные пользователя. Строка users остается,
+// чтобы сохранить ссылки из журналов аудита (смены ролей, имперсонация),
+// но в ней не остается ничего, что указывает на человека.
+func Anonymize(tx *sqlx.Tx, userID int64) error {
+	var old struct {
+		Username string `db:"username"`
+		Email    string `db:"email"`
+	}
+	if err := tx.Get(&old, "SELECT username, email FROM users WHERE id = $1", userID); err != nil {
+		return err
+	}
+
+	statements := []string{
+		"DELETE FROM sessions WHERE user_id = $1",
+		"DELETE FROM refresh_tokens WHERE user_id = $1",
+		"DELETE FROM recovery_codes WHERE user_id = $1",
+		"DELETE FROM mfa_challenges WHERE user_id = $1",
+		"DELETE FROM user_identities WHERE user_id = $1",
+		"DELETE FROM api_keys WHERE user_id = $1",
+		"DELETE FROM email_verification_tokens WHERE user_id = $1",
+		"DELETE FROM password_reset_tokens WHERE user_id = $1",
+		"DELETE FROM account_deletion_tokens WHERE user_id = $1",
+		"DELETE FROM oauth_login_codes WHERE user_id = $1",
+		"UPDATE impersonation_requests SET ip = '' WHERE target_id = $1",
+		"UPDATE invitations SET email = 'deleted_' || accepted_user_id || '@deleted.invalid' WHERE accepted_user_id = $1",
+		`UPDATE users SET
+             username = 'deleted_' || id,
+             email = 'deleted_' || id || '@deleted.invalid',
+             password = '',
+             email_verified = FALSE,
+             email_verified_at = NULL,
+             totp_secret = NULL,
+             totp_enabled = FALSE,
+             totp_last_step = NULL,
+             blocked_reason = NULL,
+             display_name = NULL,
+             bio = NULL,
+             avatar_url = NULL,
+             token_version = token_version + 1,
+             anonymized_at = NOW(),
+             deleted_at = COALESCE(deleted_at, NOW()),
+             updated_at = NOW()
+         WHERE id = $1`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, userID); err != nil {
+			return err
+		}
+	}
+
+	// Письма и счетчики входа хранят email и имя пользователя, а не ID
+	if _, err := tx.Exec("DELETE FROM email_outbox WHERE recipient = $1", old.Email); err != nil {
+		return err
+	}
+	_, err := tx.Exec("DELETE FROM login_throttles WHERE scope = $1 AND key = $2", auth.ThrottleScopeUsername, auth.NormalizeUsername(old.Username))
+	return err
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"mango/internal/models"
+	"strings"
+)
+
+// Префикс, по которому API-ключ отличается от JWT в заголовке Authorization
+const apiKeyPrefix = "mk_"
+
+var ErrInvalidAPIKey = errors.New("недействительный API-ключ")
+
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// GenerateAPIKey возвращает ключ вида mk_<prefix>_<secret>, его отображаемый префикс и хеш
+func GenerateAPIKey() (string, string, string, error) {
+	prefix, err := RandomToken(6)
+	if err != nil {
+		return "", "", "", err
+	}
+	secret, err := RandomToken(32)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	// В base64url встречается "_", заменяем его в префиксе, чтобы не путать с разделителем
+	prefix = strings.ReplaceAll(prefix, "_", "x")
+	key := apiKeyPrefix + prefix + "_" + secret
+	return key, prefix, HashToken(key), nil
+}
+
+// LookupAPIKey находит действующий ключ и отмечает время использования
+// не чаще раза в минуту
+func (s *UserStates) LookupAPIKey(key string) (*models.APIKey, error) {
+	var apiKey models.APIKey
+	err := s.DB.Get(&apiKey,
+		`SELECT id, name, prefix, key_hash, scopes, user_id, expires_at, last_used_at, revoked_at, created_at FROM api_keys
+         WHERE key_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())`,
+		HashToken(key))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	_, err = s.DB.Exec(
+		"UPDATE api_keys SET last_used_at = NOW() WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')",
+		apiKey.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiKey, nil
+}
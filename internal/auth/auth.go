@@ -1,32 +1,72 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"mango/internal/models"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
-var JwtKey = []byte("your_secret_key")
+// Время жизни access- и refresh-токенов
+var (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
 
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return string(bytes), err
-}
+func GenerateToken(user models.User, sessionID int64) (string, error) {
+	claims := jwt.MapClaims{
+		"id":   user.ID,
+		"role": user.Role,
+		"ver":  user.TokenVersion,
+		"sid":  sessionID,
+		"exp":  time.Now().Add(AccessTokenTTL).Unix(),
+	}
 
-func CheckPassword(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+	return Keys.Sign(claims)
 }
 
-func GenerateToken(user models.User) (string, error) {
+// ImpersonationTokenTTL - время жизни токена входа от имени пользователя
+var ImpersonationTokenTTL = 15 * time.Minute
+
+// GenerateImpersonationToken выпускает токен пользователя target для администратора actorID.
+// Токен помечен claims "act" (кто действует) и "imp" (сессия имперсонации).
+func GenerateImpersonationToken(target models.User, actorID, sessionID int64) (string, error) {
 	claims := jwt.MapClaims{
-		"id":   user.ID,
-		"role": user.Role,
-		"exp":  time.Now().Add(time.Hour * 24).Unix(),
+		"id":   target.ID,
+		"role": target.Role,
+		"ver":  target.TokenVersion,
+		"act":  actorID,
+		"imp":  sessionID,
+		"exp":  time.Now().Add(ImpersonationTokenTTL).Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(JwtKey)
+	return Keys.Sign(claims)
+}
+
+// RandomToken возвращает криптостойкую случайную строку из n байт в base64url
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken хеширует непрозрачный токен для хранения в БД
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateOpaqueToken возвращает случайный токен (refresh, сброс пароля и т.п.) и его хеш
+func GenerateOpaqueToken() (string, string, error) {
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	return token, HashToken(token), nil
 }
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BreachedPasswords проверяет пароли по локальной базе SHA-1 хешей утекших паролей
+// (формат Have I Been Pwned). Поддерживаются два варианта:
+//
+//   - каталог с файлами по префиксу хеша (k-anonymity): файл "5BAA6" содержит
+//     строки "1E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493" с оставшейся частью хеша;
+//     при проверке читается только файл нужного префикса;
+//   - один файл со строками "ХЕШ:ЧИСЛО" или "ХЕШ", загружаемый в память целиком
+//     (для небольших списков).
+type BreachedPasswords struct {
+	dir    string
+	hashes map[string]struct{}
+}
+
+const breachedPrefixLength = 5
+
+// LoadBreachedPasswords открывает базу утекших паролей по пути к каталогу или файлу
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &BreachedPasswords{dir: path}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	b := &BreachedPasswords{hashes: make(map[string]struct{})}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		hash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if len(hash) == sha1.Size*2 {
+			b.hashes[strings.ToUpper(hash)] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Contains сообщает, встречается ли пароль в базе
+func (b *BreachedPasswords) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	if b.hashes != nil {
+		_, ok := b.hashes[hash]
+		return ok, nil
+	}
+
+	file, err := os.Open(filepath.Join(b.dir, hash[:breachedPrefixLength]))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	suffix := hash[breachedPrefixLength:]
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(line, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key - ключ подписи/проверки JWT с идентификатором kid
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	SignKey   interface{} // nil для ключей, используемых только для проверки
+	VerifyKey interface{}
+}
+
+// KeySet хранит активный ключ подписи и все ключи, принимаемые при проверке
+type KeySet struct {
+	active *Key
+	keys   map[string]*Key
+	order  []*Key
+}
+
+// Keys - набор ключей сервера, заполняется при старте из конфигурации
+var Keys = NewKeySet()
+
+func NewKeySet() *KeySet {
+	return &KeySet{keys: make(map[string]*Key)}
+}
+
+func NewHMACKey(kid string, secret []byte) *Key {
+	return &Key{ID: kid, Method: jwt.SigningMethodHS256, SignKey: secret, VerifyKey: secret}
+}
+
+// NewRSAKey принимает PEM приватного (для подписи) или публичного ключа
+func NewRSAKey(kid string, pemData []byte) (*Key, error) {
+	if private, err := jwt.ParseRSAPrivateKeyFromPEM(pemData); err == nil {
+		return &Key{ID: kid, Method: jwt.SigningMethodRS256, SignKey: private, VerifyKey: &private.PublicKey}, nil
+	}
+	public, err := jwt.ParseRSAPublicKeyFromPEM(pemData)
+	if err != nil {
+		return nil, fmt.Errorf("ключ %s: %w", kid, err)
+	}
+	return &Key{ID: kid, Method: jwt.SigningMethodRS256, VerifyKey: public}, nil
+}
+
+// NewEdDSAKey принимает PEM приватного (для подписи) или публичного ключа Ed25519
+func NewEdDSAKey(kid string, pemData []byte) (*Key, error) {
+	if private, err := jwt.ParseEdPrivateKeyFromPEM(pemData); err == nil {
+		signer := private.(crypto.Signer)
+		return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, SignKey: private, VerifyKey: signer.Public()}, nil
+	}
+	public, err := jwt.ParseEdPublicKeyFromPEM(pemData)
+	if err != nil {
+		return nil, fmt.Errorf("ключ %s: %w", kid, err)
+	}
+	return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, VerifyKey: public}, nil
+}
+
+// Add добавляет ключ в набор; active делает его ключом подписи
+func (ks *KeySet) Add(key *Key, active bool) error {
+	if key.ID == "" {
+		return errors.New("у ключа не задан kid")
+	}
+	if _, exists := ks.keys[key.ID]; exists {
+		return fmt.Errorf("ключ %s уже добавлен", key.ID)
+	}
+	if active {
+		if key.SignKey == nil {
+			return fmt.Errorf("ключ %s не может использоваться для подписи", key.ID)
+		}
+		ks.active = key
+	}
+	ks.keys[key.ID] = key
+	ks.order = append(ks.order, key)
+	return nil
+}
+
+// Sign подписывает claims активным ключом и проставляет заголовок kid
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if ks.active == nil {
+		return "", errors.New("не настроен ключ подписи JWT")
+	}
+	token := jwt.NewWithClaims(ks.active.Method, claims)
+	token.Header["kid"] = ks.active.ID
+	return token.SignedString(ks.active.SignKey)
+}
+
+// Keyfunc выбирает ключ проверки по kid и сверяет алгоритм
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("неизвестный kid %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("алгоритм %s не соответствует ключу %s", token.Method.Alg(), kid)
+	}
+	return key.VerifyKey, nil
+}
+
+// JWKS возвращает публичные асимметричные ключи в формате RFC 7517.
+// HMAC-ключи не публикуются.
+func (ks *KeySet) JWKS() map[string]interface{} {
+	keys := []map[string]interface{}{}
+	for _, key := range ks.order {
+		switch public := key.VerifyKey.(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, map[string]interface{}{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": key.Method.Alg(),
+				"kid": key.ID,
+				"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			keys = append(keys, map[string]interface{}{
+				"kty": "OKP",
+				"crv": "Ed25519",
+				"use": "sig",
+				"alg": key.Method.Alg(),
+				"kid": key.ID,
+				"x":   base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+	return map[string]interface{}{"keys": keys}
+}
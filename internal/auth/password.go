@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Алгоритмы хеширования паролей
+const (
+	HashBcrypt   = "bcrypt"
+	HashArgon2id = "argon2id"
+)
+
+// Argon2Params - параметры argon2id; Memory в килобайтах
+type Argon2Params struct {
+	Memory     uint32
+	Time       uint32
+	Threads    uint8
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+// PasswordHasher хеширует новые пароли выбранным алгоритмом и проверяет хеши
+// любого поддерживаемого формата, чтобы можно было менять настройки без сброса паролей
+type PasswordHasher struct {
+	Algorithm  string
+	BcryptCost int
+	Argon2     Argon2Params
+}
+
+// DefaultArgon2Params - параметры argon2id по умолчанию (RFC 9106, вариант с ограниченной памятью)
+var DefaultArgon2Params = Argon2Params{Memory: 64 * 1024, Time: 3, Threads: 4, SaltLength: 16, KeyLength: 32}
+
+// Passwords - хешер, используемый HashPassword и CheckPassword
+var Passwords = &PasswordHasher{Algorithm: HashBcrypt, BcryptCost: 12, Argon2: DefaultArgon2Params}
+
+func HashPassword(password string) (string, error) {
+	return Passwords.Hash(password)
+}
+
+func CheckPassword(password, hash string) bool {
+	return Passwords.Check(password, hash)
+}
+
+// NeedsRehash сообщает, что хеш создан другим алгоритмом или с другими параметрами
+func NeedsRehash(hash string) bool {
+	return Passwords.NeedsRehash(hash)
+}
+
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	switch h.Algorithm {
+	case HashBcrypt:
+		bytes, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+		return string(bytes), err
+	case HashArgon2id:
+		return h.hashArgon2(password)
+	default:
+		return "", fmt.Errorf("неподдерживаемый алгоритм хеширования: %s", h.Algorithm)
+	}
+}
+
+func (h *PasswordHasher) Check(password, hash string) bool {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, salt, key, err := decodeArgon2(hash)
+		if err != nil {
+			return false
+		}
+		computed := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+		return subtle.ConstantTimeCompare(computed, key) == 1
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+func (h *PasswordHasher) NeedsRehash(hash string) bool {
+	switch h.Algorithm {
+	case HashBcrypt:
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost != h.BcryptCost
+	case HashArgon2id:
+		params, salt, key, err := decodeArgon2(hash)
+		if err != nil {
+			return true
+		}
+		return params.Memory != h.Argon2.Memory || params.Time != h.Argon2.Time || params.Threads != h.Argon2.Threads ||
+			uint32(len(salt)) != h.Argon2.SaltLength || uint32(len(key)) != h.Argon2.KeyLength
+	default:
+		return false
+	}
+}
+
+// Хеш в формате PHC: $argon2id$v=19$m=65536,t=3,p=4$<соль>$<ключ>
+func (h *PasswordHasher) hashArgon2(password string) (string, error) {
+	salt := make([]byte, h.Argon2.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Argon2.Time, h.Argon2.Memory, h.Argon2.Threads, h.Argon2.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Argon2.Memory, h.Argon2.Time, h.Argon2.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func decodeArgon2(hash string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, fmt.Errorf("неверный формат argon2id")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("неподдерживаемая версия argon2")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return params, nil, nil, fmt.Errorf("неверные параметры argon2id: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, fmt.Errorf("неверный ключ argon2id")
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
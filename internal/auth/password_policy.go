@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Коды причин отказа в пароле
+const (
+	PasswordTooShort         = "too_short"
+	PasswordTooLong          = "too_long"
+	PasswordContainsUsername = "contains_username"
+	PasswordContainsEmail    = "contains_email"
+	PasswordTooWeak          = "too_weak"
+	PasswordBreached         = "breached"
+)
+
+// PasswordViolation - причина, по которой пароль не принят
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicy - требования к новым паролям
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// MinScore - минимальная оценка стойкости по шкале 0-4 (как в zxcvbn)
+	MinScore int
+	// Breached - список утекших паролей; nil отключает проверку
+	Breached *BreachedPasswords
+}
+
+// Validate проверяет пароль и возвращает все нарушения; пустой результат - пароль принят
+func (p *PasswordPolicy) Validate(password, username, email string) ([]PasswordViolation, error) {
+	var violations []PasswordViolation
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, PasswordViolation{PasswordTooShort, "Пароль должен содержать не менее " + strconv.Itoa(p.MinLength) + " символов"})
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		violations = append(violations, PasswordViolation{PasswordTooLong, "Пароль должен быть не длиннее " + strconv.Itoa(p.MaxLength) + " байт"})
+	}
+
+	lower := strings.ToLower(password)
+	if username != "" && strings.Contains(lower, strings.ToLower(username)) {
+		violations = append(violations, PasswordViolation{PasswordContainsUsername, "Пароль не должен содержать имя пользователя"})
+	}
+	if local := emailLocalPart(email); len(local) >= 3 && strings.Contains(lower, local) {
+		violations = append(violations, PasswordViolation{PasswordContainsEmail, "Пароль не должен содержать email"})
+	}
+
+	if score := PasswordStrength(password, username, emailLocalPart(email)); score < p.MinScore {
+		violations = append(violations, PasswordViolation{PasswordTooWeak, "Пароль слишком простой: добавьте слов или символов, избегайте последовательностей и повторов"})
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return nil, err
+		}
+		if breached {
+			violations = append(violations, PasswordViolation{PasswordBreached, "Пароль встречается в известных утечках, выберите другой"})
+		}
+	}
+
+	return violations, nil
+}
+
+// PasswordStrength оценивает стойкость пароля по шкале 0-4 на основе примерного числа
+// попыток подбора. Как и zxcvbn, учитывает словарные слова, повторы, последовательности,
+// раскладку клавиатуры, годы и данные пользователя (userInputs).
+func PasswordStrength(password string, userInputs ...string) int {
+	bits := passwordEntropy([]rune(strings.ToLower(password)), []rune(password), userInputs)
+
+	// Пороги zxcvbn: 10^3, 10^6, 10^8, 10^10 попыток
+	switch {
+	case bits < 10:
+		return 0
+	case bits < 20:
+		return 1
+	case bits < 26.6:
+		return 2
+	case bits < 33.2:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// Слова и пароли, которые перебираются в первую очередь
+var commonPasswordWords = []string{
+	"password", "passw0rd", "qwerty", "admin", "welcome", "letmein", "monkey", "dragon", "master",
+	"login", "princess", "sunshine", "football", "baseball", "iloveyou", "trustno1", "shadow",
+	"superman", "batman", "michael", "secret", "hello", "freedom", "whatever", "starwars",
+	"manga", "anime", "naruto", "pokemon", "parol", "пароль", "привет", "любовь", "мама",
+}
+
+// Ряды клавиатуры для поиска "дорожек" вроде qwerty и йцукен
+var keyboardRows = []string{
+	"`1234567890-=", "qwertyuiop[]", "asdfghjkl;'", "zxcvbnm,./",
+	"ёйцукенгшщзхъ", "фывапролджэ", "ячсмитьбю",
+}
+
+// Сумма битов энтропии: шаблонные фрагменты оцениваются дешево, остальные символы - по размеру алфавита
+func passwordEntropy(lower, original []rune, userInputs []string) float64 {
+	var bits float64
+
+	for i := 0; i < len(lower); {
+		if n := matchWord(lower[i:], userInputs); n > 0 {
+			bits += 2
+			i += n
+			continue
+		}
+		if n := matchWord(lower[i:], commonPasswordWords); n > 0 {
+			bits += math.Log2(float64(len(commonPasswordWords))) + capitalizationBits(original[i:i+n])
+			i += n
+			continue
+		}
+		if n := matchYear(lower[i:]); n > 0 {
+			bits += math.Log2(200)
+			i += n
+			continue
+		}
+
+		bits += charBits(original[i])
+		i++
+
+		// Повторы, последовательности и соседние клавиши почти не добавляют стойкости
+		for i < len(lower) && isPatternContinuation(lower[i-1], lower[i]) {
+			bits++
+			i++
+		}
+	}
+
+	return bits
+}
+
+func matchWord(s []rune, words []string) int {
+	best := 0
+	for _, word := range words {
+		w := []rune(strings.ToLower(word))
+		if len(w) < 3 || len(w) > len(s) || len(w) <= best {
+			continue
+		}
+		if string(s[:len(w)]) == string(w) {
+			best = len(w)
+		}
+	}
+	return best
+}
+
+func matchYear(s []rune) int {
+	if len(s) < 4 {
+		return 0
+	}
+	prefix := string(s[:2])
+	if (prefix == "19" || prefix == "20") && unicode.IsDigit(s[2]) && unicode.IsDigit(s[3]) {
+		return 4
+	}
+	return 0
+}
+
+func isPatternContinuation(prev, cur rune) bool {
+	if cur == prev || cur == prev+1 || cur == prev-1 {
+		return true
+	}
+	for _, row := range keyboardRows {
+		r := []rune(row)
+		for j := 0; j+1 < len(r); j++ {
+			if (r[j] == prev && r[j+1] == cur) || (r[j] == cur && r[j+1] == prev) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func charBits(r rune) float64 {
+	switch {
+	case unicode.IsDigit(r):
+		return math.Log2(10)
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		return math.Log2(26)
+	default:
+		// Кириллица и спецсимволы
+		return math.Log2(33)
+	}
+}
+
+// Заглавная первая буква почти ничего не добавляет, смешанный регистр - немного больше
+func capitalizationBits(word []rune) float64 {
+	upper := 0
+	for _, r := range word {
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+	switch {
+	case upper == 0:
+		return 0
+	case upper == 1 && unicode.IsUpper(word[0]), upper == len(word):
+		return 1
+	default:
+		return float64(len(word)) / 2
+	}
+}
+
+func emailLocalPart(email string) string {
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+	return local
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"fmt"
+	"mango/internal/models"
+	"strings"
+)
+
+// Действия, которые можно закрыть до подтверждения email
+const (
+	ActionLogin = "login"
+)
+
+var emailPolicyActions = map[string]bool{
+	ActionLogin: true,
+}
+
+// EmailPolicy - набор действий, требующих подтвержденного email
+type EmailPolicy map[string]bool
+
+// ParseEmailPolicy разбирает список действий через запятую, например "login".
+// Неизвестное действие - ошибка: опечатка в настройке не должна молча отключать проверку.
+func ParseEmailPolicy(value string) (EmailPolicy, error) {
+	policy := EmailPolicy{}
+	for _, action := range strings.Split(value, ",") {
+		if action = strings.TrimSpace(action); action != "" {
+			if !emailPolicyActions[action] {
+				return nil, fmt.Errorf("неизвестное действие для подтверждения email: %s", action)
+			}
+			policy[action] = true
+		}
+	}
+	return policy, nil
+}
+
+func (p EmailPolicy) Requires(action string) bool {
+	return p[action]
+}
+
+// TwoFactorPolicy - роли, для которых двухфакторная аутентификация обязательна
+type TwoFactorPolicy map[models.Role]bool
+
+// ParseTwoFactorPolicy разбирает список ролей через запятую, например "admin,super_admin"
+func ParseTwoFactorPolicy(value string) TwoFactorPolicy {
+	policy := TwoFactorPolicy{}
+	for _, role := range strings.Split(value, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			policy[models.Role(role)] = true
+		}
+	}
+	return policy
+}
+
+func (p TwoFactorPolicy) Requires(role models.Role) bool {
+	return p[role]
+}
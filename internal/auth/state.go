@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"mango/internal/models"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrUserNotFound = errors.New("пользователь не найден")
+
+// Максимальное число записей в кеше состояний
+const maxCachedStates = 10000
+
+// UserState - актуальное состояние учетной записи, с которым сверяется токен
+type UserState struct {
+	ID           int64       `db:"id"`
+	Role         models.Role `db:"role"`
+	IsBlocked    bool        `db:"is_blocked"`
+	TOTPEnabled  bool        `db:"totp_enabled"`
+	TokenVersion int         `db:"token_version"`
+}
+
+type stateEntry struct {
+	state   *UserState
+	expires time.Time
+}
+
+type sessionEntry struct {
+	active  bool
+	expires time.Time
+}
+
+type permissionsEntry struct {
+	permissions map[models.Permission]bool
+	expires     time.Time
+}
+
+// UserStates - небольшой кеш состояний пользователей и прав ролей поверх Postgres
+type UserStates struct {
+	DB  *sqlx.DB
+	TTL time.Duration
+
+	mu             sync.Mutex
+	entries        map[int64]stateEntry
+	roles          map[models.Role]permissionsEntry
+	sessions       map[int64]sessionEntry
+	impersonations map[int64]sessionEntry
+}
+
+func NewUserStates(db *sqlx.DB, ttl time.Duration) *UserStates {
+	return &UserStates{
+		DB:             db,
+		TTL:            ttl,
+		entries:        make(map[int64]stateEntry),
+		roles:          make(map[models.Role]permissionsEntry),
+		sessions:       make(map[int64]sessionEntry),
+		impersonations: make(map[int64]sessionEntry),
+	}
+}
+
+// Get возвращает состояние пользователя из кеша или БД.
+// Для удаленного пользователя возвращает ErrUserNotFound.
+func (s *UserStates) Get(userID int64) (*UserState, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	entry, ok := s.entries[userID]
+	s.mu.Unlock()
+
+	if ok && now.Before(entry.expires) {
+		if entry.state == nil {
+			return nil, ErrUserNotFound
+		}
+		return entry.state, nil
+	}
+
+	var state UserState
+	err := s.DB.Get(&state, "SELECT id, role, "+models.IsBlockedSQL+", totp_enabled, token_version FROM users WHERE id = $1 AND deleted_at IS NULL", userID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	entry = stateEntry{expires: now.Add(s.TTL)}
+	if err == nil {
+		entry.state = &state
+	}
+
+	s.mu.Lock()
+	if len(s.entries) >= maxCachedStates {
+		s.evictExpired(now)
+	}
+	s.entries[userID] = entry
+	s.mu.Unlock()
+
+	if entry.state == nil {
+		return nil, ErrUserNotFound
+	}
+	return entry.state, nil
+}
+
+// Invalidate сбрасывает кеш пользователя после изменения его учетной записи
+func (s *UserStates) Invalidate(userID int64) {
+	s.mu.Lock()
+	delete(s.entries, userID)
+	s.mu.Unlock()
+}
+
+// HasPermission проверяет, есть ли у роли указанное право
+func (s *UserStates) HasPermission(role models.Role, permission models.Permission) (bool, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	entry, ok := s.roles[role]
+	s.mu.Unlock()
+
+	if !ok || !now.Before(entry.expires) {
+		var permissions []models.Permission
+		err := s.DB.Select(&permissions, "SELECT permission FROM role_permissions WHERE role = $1", role)
+		if err != nil {
+			return false, err
+		}
+
+		entry = permissionsEntry{permissions: make(map[models.Permission]bool), expires: now.Add(s.TTL)}
+		for _, p := range permissions {
+			entry.permissions[p] = true
+		}
+
+		s.mu.Lock()
+		s.roles[role] = entry
+		s.mu.Unlock()
+	}
+
+	return entry.permissions[models.PermissionAll] || entry.permissions[permission], nil
+}
+
+// InvalidateRoles сбрасывает кеш прав после изменения ролей
+func (s *UserStates) InvalidateRoles() {
+	s.mu.Lock()
+	s.roles = make(map[models.Role]permissionsEntry)
+	s.mu.Unlock()
+}
+
+// SessionActive проверяет, что сессия не завершена и не истекла
+func (s *UserStates) SessionActive(sessionID int64) (bool, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	entry, ok := s.sessions[sessionID]
+	s.mu.Unlock()
+
+	if ok && now.Before(entry.expires) {
+		return entry.active, nil
+	}
+
+	var active bool
+	err := s.DB.Get(&active,
+		"SELECT EXISTS(SELECT 1 FROM sessions WHERE id = $1 AND revoked_at IS NULL AND expires_at > NOW())",
+		sessionID)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	if len(s.sessions) >= maxCachedStates {
+		s.sessions = make(map[int64]sessionEntry)
+	}
+	s.sessions[sessionID] = sessionEntry{active: active, expires: now.Add(s.TTL)}
+	s.mu.Unlock()
+
+	return active, nil
+}
+
+// ImpersonationActive проверяет, что сессия имперсонации не завершена и не истекла
+func (s *UserStates) ImpersonationActive(sessionID int64) (bool, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	entry, ok := s.impersonations[sessionID]
+	s.mu.Unlock()
+
+	if ok && now.Before(entry.expires) {
+		return entry.active, nil
+	}
+
+	var active bool
+	err := s.DB.Get(&active,
+		"SELECT EXISTS(SELECT 1 FROM impersonation_sessions WHERE id = $1 AND ended_at IS NULL AND expires_at > NOW())",
+		sessionID)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	if len(s.impersonations) >= maxCachedStates {
+		s.impersonations = make(map[int64]sessionEntry)
+	}
+	s.impersonations[sessionID] = sessionEntry{active: active, expires: now.Add(s.TTL)}
+	s.mu.Unlock()
+
+	return active, nil
+}
+
+// InvalidateImpersonation сбрасывает кеш завершенной сессии имперсонации
+func (s *UserStates) InvalidateImpersonation(sessionID int64) {
+	s.mu.Lock()
+	delete(s.impersonations, sessionID)
+	s.mu.Unlock()
+}
+
+// InvalidateSessions сбрасывает кеш завершенных сессий
+func (s *UserStates) InvalidateSessions(sessionIDs ...int64) {
+	s.mu.Lock()
+	for _, id := range sessionIDs {
+		delete(s.sessions, id)
+	}
+	s.mu.Unlock()
+}
+
+func (s *UserStates) evictExpired(now time.Time) {
+	for id, entry := range s.entries {
+		if !now.Before(entry.expires) {
+			delete(s.entries, id)
+		}
+	}
+	// Если кеш все еще переполнен, начинаем заново
+	if len(s.entries) >= maxCachedStates {
+		s.entries = make(map[int64]stateEntry)
+	}
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Области учета неудачных попыток входа
+const (
+	ThrottleScopeUsername = "username"
+	ThrottleScopeIP       = "ip"
+)
+
+// ThrottleLimits - параметры ограничения для одной области
+type ThrottleLimits struct {
+	FreeAttempts    int           // попыток без задержки
+	LockoutAttempts int           // после стольких попыток включается блокировка
+	LockoutDuration time.Duration // длительность временной блокировки
+}
+
+// LoginThrottle учитывает неудачные попытки входа по имени пользователя и IP
+// и вычисляет экспоненциально растущую задержку до следующей попытки
+type LoginThrottle struct {
+	DB       *sqlx.DB
+	Username ThrottleLimits
+	IP       ThrottleLimits
+	// Начальная и максимальная задержка после исчерпания бесплатных попыток
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Счетчик сбрасывается, если неудачных попыток не было дольше Window
+	Window time.Duration
+	// Периодичность удаления устаревших записей
+	PruneInterval time.Duration
+}
+
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// Check возвращает время, которое нужно подождать перед следующей попыткой
+func (t *LoginThrottle) Check(username, ip string) (time.Duration, error) {
+	var seconds float64
+	err := t.DB.Get(&seconds,
+		`SELECT COALESCE(MAX(EXTRACT(EPOCH FROM (locked_until - NOW()))), 0) FROM login_throttles
+         WHERE ((scope = $1 AND key = $2) OR (scope = $3 AND key = $4)) AND locked_until > NOW()`,
+		ThrottleScopeUsername, NormalizeUsername(username), ThrottleScopeIP, ip)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(math.Ceil(seconds)) * time.Second, nil
+}
+
+// RecordFailure учитывает неудачную попытку и при необходимости блокирует вход
+func (t *LoginThrottle) RecordFailure(username, ip string) error {
+	if err := t.recordFailure(ThrottleScopeUsername, NormalizeUsername(username), t.Username); err != nil {
+		return err
+	}
+	return t.recordFailure(ThrottleScopeIP, ip, t.IP)
+}
+
+// RecordSuccess сбрасывает счетчик пользователя после успешного входа
+func (t *LoginThrottle) RecordSuccess(username string) error {
+	_, err := t.DB.Exec("DELETE FROM login_throttles WHERE scope = $1 AND key = $2", ThrottleScopeUsername, NormalizeUsername(username))
+	return err
+}
+
+// Run периодически удаляет устаревшие записи до отмены контекста
+func (t *LoginThrottle) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.PruneInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := t.Prune(); err != nil {
+			log.Printf("Ошибка очистки счетчиков входа: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Prune удаляет счетчики без действующей блокировки, которые уже сбросились бы по Window.
+// Иначе попытки входа под случайными именами и с разных IP растят таблицу без ограничений.
+func (t *LoginThrottle) Prune() error {
+	_, err := t.DB.Exec(
+		`DELETE FROM login_throttles
+         WHERE last_failure_at < NOW() - $1 * INTERVAL '1 second'
+           AND (locked_until IS NULL OR locked_until <= NOW())`,
+		t.Window.Seconds())
+	return err
+}
+
+func (t *LoginThrottle) recordFailure(scope, key string, limits ThrottleLimits) error {
+	var failures int
+	err := t.DB.Get(&failures,
+		`INSERT INTO login_throttles (scope, key, failures, last_failure_at) VALUES ($1, $2, 1, NOW())
+         ON CONFLICT (scope, key) DO UPDATE SET
+             failures = CASE WHEN login_throttles.last_failure_at < NOW() - $3 * INTERVAL '1 second'
+                             THEN 1 ELSE login_throttles.failures + 1 END,
+             last_failure_at = NOW()
+         RETURNING failures`,
+		scope, key, t.Window.Seconds())
+	if err != nil {
+		return err
+	}
+
+	delay := t.delay(failures, limits)
+	if delay == 0 {
+		return nil
+	}
+
+	_, err = t.DB.Exec("UPDATE login_throttles SET locked_until = NOW() + $1 * INTERVAL '1 second' WHERE scope = $2 AND key = $3",
+		delay.Seconds(), scope, key)
+	return err
+}
+
+func (t *LoginThrottle) delay(failures int, limits ThrottleLimits) time.Duration {
+	if failures >= limits.LockoutAttempts {
+		return limits.LockoutDuration
+	}
+	if failures < limits.FreeAttempts {
+		return 0
+	}
+
+	delay := t.BaseDelay << (failures - limits.FreeAttempts)
+	if delay > t.MaxDelay || delay <= 0 {
+		delay = t.MaxDelay
+	}
+	return delay
+}
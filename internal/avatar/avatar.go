@@ -0,0 +1,113 @@
+package avatar
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+
+	// Поддерживаемые форматы загрузки
+	_ "image/gif"
+	_ "image/png"
+)
+
+// Ограничения на загружаемые изображения
+const (
+	Size         = 256
+	MaxDimension = 4096
+	jpegQuality  = 85
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("Поддерживаются только изображения JPEG, PNG и GIF")
+	ErrTooLarge          = errors.New("Изображение слишком большое: максимум 4096x4096 пикселей")
+	ErrTooSmall          = errors.New("Изображение слишком маленькое: минимум 32x32 пикселя")
+)
+
+// Process проверяет изображение, обрезает его до квадрата по центру,
+// уменьшает до Size пикселей и перекодирует в JPEG. Перекодирование
+// заодно отбрасывает метаданные (EXIF с геолокацией и т.п.).
+func Process(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Размеры проверяются до декодирования, чтобы не распаковывать огромные изображения
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (format != "jpeg" && format != "png" && format != "gif") {
+		return nil, ErrUnsupportedFormat
+	}
+	if config.Width > MaxDimension || config.Height > MaxDimension {
+		return nil, ErrTooLarge
+	}
+	if config.Width < 32 || config.Height < 32 {
+		return nil, ErrTooSmall
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+
+	dst := resizeSquare(src, Size)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// resizeSquare вырезает центральный квадрат и уменьшает его усреднением по площади.
+// Прозрачные области заливаются белым, так как JPEG не поддерживает прозрачность.
+func resizeSquare(src image.Image, size int) *image.RGBA {
+	bounds := src.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(
+		bounds.Min.X+(bounds.Dx()-side)/2,
+		bounds.Min.Y+(bounds.Dy()-side)/2,
+	))
+
+	// Переводим в RGBA на белом фоне, чтобы дальше работать с байтами напрямую
+	flat := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(flat, flat.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), src, crop.Min, draw.Over)
+
+	if side <= size {
+		return flat
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		y0, y1 := y*side/size, (y+1)*side/size
+		for x := 0; x < size; x++ {
+			x0, x1 := x*side/size, (x+1)*side/size
+
+			var r, g, b, n int
+			for sy := y0; sy < y1; sy++ {
+				row := flat.Pix[sy*flat.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += int(p[0])
+					g += int(p[1])
+					b += int(p[2])
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = 255
+		}
+	}
+	return dst
+}
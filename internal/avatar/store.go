@@ -0,0 +1,51 @@
+package avatar
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// URLPrefix - путь, по которому сервер раздает сохраненные аватары
+const URLPrefix = "/uploads/avatars/"
+
+// Store хранит обработанные аватары в каталоге на диске
+type Store struct {
+	Dir string
+}
+
+// Save записывает аватар пользователя и возвращает его URL.
+// Имя файла случайное, чтобы после замены не отдавался закешированный старый аватар.
+func (s *Store) Save(userID int64, data []byte) (string, error) {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return "", err
+	}
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	name := strconv.FormatInt(userID, 10) + "-" + hex.EncodeToString(suffix) + ".jpg"
+
+	if err := os.WriteFile(filepath.Join(s.Dir, name), data, 0o644); err != nil {
+		return "", err
+	}
+	return URLPrefix + name, nil
+}
+
+// Remove удаляет файл аватара по URL; URL вне каталога хранилища игнорируются
+func (s *Store) Remove(url string) error {
+	name := strings.TrimPrefix(url, URLPrefix)
+	if name == url || name == "" || strings.ContainsAny(name, `/\`) {
+		return nil
+	}
+
+	err := os.Remove(filepath.Join(s.Dir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
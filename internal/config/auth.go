@@ -0,0 +1,177 @@
+package config
+
+import (
+	"fmt"
+	"mango/internal/auth"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EmailPolicy - действия, недоступные до подтверждения email (EMAIL_VERIFICATION_REQUIRED_FOR)
+func EmailPolicy() (auth.EmailPolicy, error) {
+	policy, err := auth.ParseEmailPolicy(getEnv("EMAIL_VERIFICATION_REQUIRED_FOR", ""))
+	if err != nil {
+		return nil, fmt.Errorf("EMAIL_VERIFICATION_REQUIRED_FOR: %w", err)
+	}
+	return policy, nil
+}
+
+// TwoFactorPolicy - роли с обязательной двухфакторной аутентификацией (TWO_FACTOR_REQUIRED_ROLES)
+func TwoFactorPolicy() auth.TwoFactorPolicy {
+	return auth.ParseTwoFactorPolicy(getEnv("TWO_FACTOR_REQUIRED_ROLES", ""))
+}
+
+// LoadPasswordHasher настраивает хеширование паролей:
+//
+//	PASSWORD_HASH_ALG       - bcrypt (по умолчанию) или argon2id
+//	PASSWORD_BCRYPT_COST    - cost для bcrypt (по умолчанию 12)
+//	PASSWORD_ARGON2_MEMORY  - память argon2id в КиБ (по умолчанию 65536)
+//	PASSWORD_ARGON2_TIME    - число проходов argon2id (по умолчанию 3)
+//	PASSWORD_ARGON2_THREADS - число потоков argon2id (по умолчанию 4)
+//
+// Хеши с прежними параметрами продолжают проверяться и пересчитываются при входе.
+func LoadPasswordHasher() (*auth.PasswordHasher, error) {
+	hasher := &auth.PasswordHasher{
+		Algorithm: getEnv("PASSWORD_HASH_ALG", auth.HashBcrypt),
+		Argon2:    auth.DefaultArgon2Params,
+	}
+
+	cost, err := getEnvInt("PASSWORD_BCRYPT_COST", 12)
+	if err != nil {
+		return nil, err
+	}
+	memory, err := getEnvInt("PASSWORD_ARGON2_MEMORY", int(auth.DefaultArgon2Params.Memory))
+	if err != nil {
+		return nil, err
+	}
+	passes, err := getEnvInt("PASSWORD_ARGON2_TIME", int(auth.DefaultArgon2Params.Time))
+	if err != nil {
+		return nil, err
+	}
+	threads, err := getEnvInt("PASSWORD_ARGON2_THREADS", int(auth.DefaultArgon2Params.Threads))
+	if err != nil {
+		return nil, err
+	}
+
+	switch hasher.Algorithm {
+	case auth.HashBcrypt:
+		if cost < 10 || cost > 31 {
+			return nil, fmt.Errorf("PASSWORD_BCRYPT_COST должен быть от 10 до 31")
+		}
+	case auth.HashArgon2id:
+		if memory < 8*1024 || passes < 1 || threads < 1 || threads > 255 {
+			return nil, fmt.Errorf("некорректные параметры argon2id")
+		}
+	default:
+		return nil, fmt.Errorf("неподдерживаемый PASSWORD_HASH_ALG: %s", hasher.Algorithm)
+	}
+
+	hasher.BcryptCost = cost
+	hasher.Argon2.Memory = uint32(memory)
+	hasher.Argon2.Time = uint32(passes)
+	hasher.Argon2.Threads = uint8(threads)
+
+	return hasher, nil
+}
+
+func getEnvInt(key string, defaultValue int) (int, error) {
+	value := getEnv(key, "")
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s должен быть числом: %w", key, err)
+	}
+	return n, nil
+}
+
+// LoadPasswordPolicy настраивает требования к паролям:
+//
+//	PASSWORD_MIN_LENGTH    - минимальная длина в символах (по умолчанию 8)
+//	PASSWORD_MAX_LENGTH    - максимальная длина в байтах (по умолчанию 72 - предел bcrypt)
+//	PASSWORD_MIN_SCORE     - минимальная оценка стойкости 0-4 (по умолчанию 2)
+//	PASSWORD_BREACHED_LIST - каталог с файлами по префиксу SHA-1 или файл с хешами утекших паролей
+func LoadPasswordPolicy() (*auth.PasswordPolicy, error) {
+	minLength, err := getEnvInt("PASSWORD_MIN_LENGTH", 8)
+	if err != nil {
+		return nil, err
+	}
+	maxLength, err := getEnvInt("PASSWORD_MAX_LENGTH", 72)
+	if err != nil {
+		return nil, err
+	}
+	minScore, err := getEnvInt("PASSWORD_MIN_SCORE", 2)
+	if err != nil {
+		return nil, err
+	}
+	if minScore < 0 || minScore > 4 {
+		return nil, fmt.Errorf("PASSWORD_MIN_SCORE должен быть от 0 до 4")
+	}
+
+	policy := &auth.PasswordPolicy{MinLength: minLength, MaxLength: maxLength, MinScore: minScore}
+
+	if path := getEnv("PASSWORD_BREACHED_LIST", ""); path != "" {
+		breached, err := auth.LoadBreachedPasswords(path)
+		if err != nil {
+			return nil, fmt.Errorf("список утекших паролей: %w", err)
+		}
+		policy.Breached = breached
+	}
+
+	return policy, nil
+}
+
+// AccountDeletionGrace - срок, в течение которого можно отменить удаление аккаунта
+// (ACCOUNT_DELETION_GRACE_DAYS, по умолчанию 14 дней)
+func AccountDeletionGrace() (time.Duration, error) {
+	days, err := getEnvInt("ACCOUNT_DELETION_GRACE_DAYS", 14)
+	if err != nil {
+		return 0, err
+	}
+	if days < 0 {
+		return 0, fmt.Errorf("ACCOUNT_DELETION_GRACE_DAYS не может быть отрицательным")
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+// DeletedUserRetention - срок хранения данных пользователя, удаленного администратором,
+// до обезличивания (DELETED_USER_RETENTION_DAYS, по умолчанию 30 дней)
+func DeletedUserRetention() (time.Duration, error) {
+	days, err := getEnvInt("DELETED_USER_RETENTION_DAYS", 30)
+	if err != nil {
+		return 0, err
+	}
+	if days < 0 {
+		return 0, fmt.Errorf("DELETED_USER_RETENTION_DAYS не может быть отрицательным")
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+// InviteOnly - регистрация только по приглашениям (REGISTRATION_MODE=invite);
+// по умолчанию регистрация открыта (REGISTRATION_MODE=open)
+func InviteOnly() (bool, error) {
+	switch mode := getEnv("REGISTRATION_MODE", "open"); mode {
+	case "open":
+		return false, nil
+	case "invite":
+		return true, nil
+	default:
+		return false, fmt.Errorf("неподдерживаемый REGISTRATION_MODE: %s", mode)
+	}
+}
+
+// TrustedProxies - адреса или подсети прокси через запятую (TRUSTED_PROXIES), которым
+// разрешено передавать IP клиента в X-Forwarded-For. По умолчанию заголовку не доверяем:
+// иначе клиент подставляет произвольный IP и обходит ограничение попыток входа.
+func TrustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(getEnv("TRUSTED_PROXIES", ""), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
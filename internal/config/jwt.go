@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"mango/internal/auth"
+	"os"
+	"strings"
+)
+
+// LoadJWTKeys собирает набор ключей JWT из переменных окружения:
+//
+//	JWT_ALG              - алгоритм подписи: HS256 (по умолчанию), RS256 или EdDSA
+//	JWT_KID              - идентификатор активного ключа (по умолчанию "primary")
+//	JWT_SECRET           - секрет активного ключа для HS256
+//	JWT_PRIVATE_KEY_FILE - PEM-файл приватного ключа для RS256/EdDSA
+//	JWT_VERIFY_KEYS      - дополнительные ключи только для проверки в формате
+//	                       "kid:ALG:значение,...", где значение - секрет для HS256
+//	                       или путь к PEM-файлу публичного ключа для RS256/EdDSA
+//
+// Для ротации новый ключ делается активным, а прежний переносится в JWT_VERIFY_KEYS
+// до истечения всех выданных им токенов.
+func LoadJWTKeys() (*auth.KeySet, error) {
+	keys := auth.NewKeySet()
+
+	alg := getEnv("JWT_ALG", "HS256")
+	kid := getEnv("JWT_KID", "primary")
+
+	var active *auth.Key
+	switch alg {
+	case "HS256":
+		secret := os.Getenv("JWT_SECRET")
+		if secret == "" {
+			generated, err := auth.RandomToken(32)
+			if err != nil {
+				return nil, err
+			}
+			secret = generated
+			log.Println("JWT_SECRET не задан: используется случайный ключ, токены станут недействительны после перезапуска")
+		}
+		active = auth.NewHMACKey(kid, []byte(secret))
+	case "RS256", "EdDSA":
+		path := os.Getenv("JWT_PRIVATE_KEY_FILE")
+		if path == "" {
+			return nil, fmt.Errorf("для %s требуется JWT_PRIVATE_KEY_FILE", alg)
+		}
+		key, err := loadPEMKey(kid, alg, path)
+		if err != nil {
+			return nil, err
+		}
+		active = key
+	default:
+		return nil, fmt.Errorf("неподдерживаемый JWT_ALG: %s", alg)
+	}
+
+	if err := keys.Add(active, true); err != nil {
+		return nil, err
+	}
+
+	for _, entry := range strings.Split(os.Getenv("JWT_VERIFY_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("неверный формат JWT_VERIFY_KEYS: %q", entry)
+		}
+
+		var key *auth.Key
+		if parts[1] == "HS256" {
+			key = auth.NewHMACKey(parts[0], []byte(parts[2]))
+			key.SignKey = nil
+		} else {
+			var err error
+			key, err = loadPEMKey(parts[0], parts[1], parts[2])
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if err := keys.Add(key, false); err != nil {
+			return nil, err
+		}
+	}
+
+	return keys, nil
+}
+
+func loadPEMKey(kid, alg, path string) (*auth.Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("чтение ключа %s: %w", kid, err)
+	}
+
+	switch alg {
+	case "RS256":
+		return auth.NewRSAKey(kid, data)
+	case "EdDSA":
+		return auth.NewEdDSAKey(kid, data)
+	default:
+		return nil, fmt.Errorf("неподдерживаемый алгоритм ключа %s: %s", kid, alg)
+	}
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"fmt"
+	"mango/internal/mailer"
+	"strings"
+)
+
+// LoadMailer выбирает способ доставки писем по MAIL_DRIVER: smtp, file (письма
+// в каталог MAIL_DIR) или log (только получатель и тема, для разработки).
+// Значения по умолчанию нет: без явной настройки сервер не запускается,
+// чтобы письма со ссылками сброса пароля не терялись молча.
+func LoadMailer() (mailer.Mailer, error) {
+	from := getEnv("MAIL_FROM", "Mango <noreply@mango.local>")
+
+	switch getEnv("MAIL_DRIVER", "") {
+	case "":
+		return nil, fmt.Errorf("не задан MAIL_DRIVER: укажите smtp, file или log")
+	case "smtp":
+		return &mailer.SMTPMailer{
+			Host:     getEnv("SMTP_HOST", "localhost"),
+			Port:     getEnv("SMTP_PORT", "587"),
+			Username: getEnv("SMTP_USERNAME", ""),
+			Password: getEnv("SMTP_PASSWORD", ""),
+			From:     from,
+		}, nil
+	case "file":
+		return &mailer.FileMailer{Dir: getEnv("MAIL_DIR", "mail"), From: from}, nil
+	case "log":
+		return &mailer.FileMailer{From: from}, nil
+	default:
+		return nil, fmt.Errorf("неподдерживаемый MAIL_DRIVER: %s", getEnv("MAIL_DRIVER", ""))
+	}
+}
+
+// AppURL - публичный адрес приложения для ссылок в письмах
+func AppURL() string {
+	return strings.TrimRight(getEnv("APP_URL", "http://localhost:8080"), "/")
+}
+
+// UploadDir - каталог для загружаемых файлов (UPLOAD_DIR)
+func UploadDir() string {
+	return getEnv("UPLOAD_DIR", "uploads")
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+	"mango/internal/oidc"
+	"strings"
+)
+
+// LoadOIDCProviders читает провайдеров входа через OpenID Connect:
+//
+//	OIDC_PROVIDERS              - список имен через запятую, например "google,mock"
+//	OIDC_REDIRECT_BASE          - внешний адрес API для redirect_uri
+//	                              (по умолчанию http://127.0.0.1:8080/api)
+//	OIDC_<ИМЯ>_ISSUER           - issuer провайдера (discovery по /.well-known/openid-configuration)
+//	OIDC_<ИМЯ>_CLIENT_ID        - идентификатор клиента
+//	OIDC_<ИМЯ>_CLIENT_SECRET    - секрет клиента (может быть пустым для публичных клиентов)
+//	OIDC_<ИМЯ>_SCOPES           - scopes через пробел (по умолчанию "openid email profile")
+//
+// redirect_uri, который нужно зарегистрировать у провайдера: <OIDC_REDIRECT_BASE>/oauth/<имя>/callback
+func LoadOIDCProviders() (map[string]*oidc.Provider, error) {
+	providers := make(map[string]*oidc.Provider)
+	redirectBase := strings.TrimRight(getEnv("OIDC_REDIRECT_BASE", "http://127.0.0.1:8080/api"), "/")
+
+	for _, name := range strings.Split(getEnv("OIDC_PROVIDERS", ""), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		issuer := getEnv(prefix+"ISSUER", "")
+		clientID := getEnv(prefix+"CLIENT_ID", "")
+		if issuer == "" || clientID == "" {
+			return nil, fmt.Errorf("для провайдера %s нужно задать %sISSUER и %sCLIENT_ID", name, prefix, prefix)
+		}
+
+		providers[name] = oidc.NewProvider(
+			name,
+			issuer,
+			clientID,
+			getEnv(prefix+"CLIENT_SECRET", ""),
+			redirectBase+"/oauth/"+name+"/callback",
+			strings.Fields(getEnv(prefix+"SCOPES", "openid email profile")),
+		)
+	}
+
+	return providers, nil
+}
@@ -0,0 +1,389 @@
+package handlers
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"mango/internal/auth"
+	"mango/internal/mailer"
+	"mango/internal/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// Время жизни ссылки подтверждения удаления аккаунта
+const accountDeletionTTL = time.Hour
+
+// Пароль можно не указывать: тогда подтверждение придет ссылкой на email.
+// Так удаляют аккаунт пользователи, зарегистрированные через OAuth и не знающие пароля.
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+type ConfirmAccountDeletionRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type exportProfile struct {
+	ID                  int64      `db:"id" json:"id"`
+	Username            string     `db:"username" json:"username"`
+	Email               string     `db:"email" json:"email"`
+	DisplayName         *string    `db:"display_name" json:"display_name"`
+	Bio                 *string    `db:"bio" json:"bio"`
+	AvatarURL           *string    `db:"avatar_url" json:"avatar_url"`
+	Role                string     `db:"role" json:"role"`
+	EmailVerified       bool       `db:"email_verified" json:"email_verified"`
+	TOTPEnabled         bool       `db:"totp_enabled" json:"totp_enabled"`
+	DeletionScheduledAt *time.Time `db:"deletion_scheduled_at" json:"deletion_scheduled_at"`
+	CreatedAt           time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt           time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+type exportIdentity struct {
+	Provider    string     `db:"provider" json:"provider"`
+	Subject     string     `db:"subject" json:"subject"`
+	Email       *string    `db:"email" json:"email"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	LastLoginAt *time.Time `db:"last_login_at" json:"last_login_at"`
+}
+
+type exportSession struct {
+	UserAgent  string     `db:"user_agent" json:"user_agent"`
+	IP         string     `db:"ip" json:"ip"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	LastSeenAt time.Time  `db:"last_seen_at" json:"last_seen_at"`
+	ExpiresAt  time.Time  `db:"expires_at" json:"expires_at"`
+	RevokedAt  *time.Time `db:"revoked_at" json:"revoked_at"`
+}
+
+type exportRoleChange struct {
+	OldRole   string    `db:"old_role" json:"old_role"`
+	NewRole   string    `db:"new_role" json:"new_role"`
+	Reason    string    `db:"reason" json:"reason"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+type exportImpersonation struct {
+	Reason    string    `db:"reason" json:"reason"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	ExpiresAt time.Time `db:"expires_at" json:"expires_at"`
+}
+
+// accountExport - все данные пользователя; каждое поле попадает в отдельный файл ZIP-архива
+type accountExport struct {
+	ExportedAt     time.Time             `json:"exported_at"`
+	Profile        exportProfile         `json:"profile"`
+	Identities     []exportIdentity      `json:"identities"`
+	Sessions       []exportSession       `json:"sessions"`
+	APIKeys        []models.APIKey       `json:"api_keys"`
+	RoleChanges    []exportRoleChange    `json:"role_changes"`
+	Impersonations []exportImpersonation `json:"impersonations"`
+}
+
+// Выгрузка персональных данных пользователя (format=json или format=zip)
+func (h *UserHandler) ExportData(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Формат должен быть json или zip"})
+		return
+	}
+
+	userID := c.GetInt64("userID")
+	data := accountExport{ExportedAt: time.Now().UTC()}
+
+	err := h.DB.Get(&data.Profile,
+		"SELECT id, username, email, display_name, bio, avatar_url, role, email_verified, totp_enabled, deletion_scheduled_at, created_at, updated_at FROM users WHERE id = $1",
+		userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	queries := []struct {
+		dest  interface{}
+		query string
+	}{
+		{&data.Identities, "SELECT provider, subject, email, created_at, last_login_at FROM user_identities WHERE user_id = $1 ORDER BY created_at"},
+		{&data.Sessions, "SELECT user_agent, ip, created_at, last_seen_at, expires_at, revoked_at FROM sessions WHERE user_id = $1 ORDER BY created_at"},
+		{&data.APIKeys, "SELECT id, name, prefix, key_hash, scopes, user_id, expires_at, last_used_at, revoked_at, created_at FROM api_keys WHERE user_id = $1 ORDER BY created_at"},
+		{&data.RoleChanges, "SELECT old_role, new_role, reason, created_at FROM role_changes WHERE user_id = $1 ORDER BY created_at"},
+		{&data.Impersonations, "SELECT reason, created_at, expires_at FROM impersonation_sessions WHERE target_id = $1 ORDER BY created_at"},
+	}
+	for _, q := range queries {
+		if err := h.DB.Select(q.dest, q.query, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+			return
+		}
+	}
+
+	filename := "mango-export-" + strconv.FormatInt(userID, 10) + "-" + data.ExportedAt.Format("20060102")
+	if format == "json" {
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+		c.IndentedJSON(http.StatusOK, data)
+		return
+	}
+
+	files := []struct {
+		name  string
+		value interface{}
+	}{
+		{"profile.json", data.Profile},
+		{"identities.json", data.Identities},
+		{"sessions.json", data.Sessions},
+		{"api_keys.json", data.APIKeys},
+		{"role_changes.json", data.RoleChanges},
+		{"impersonations.json", data.Impersonations},
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`.zip"`)
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+
+	archive := zip.NewWriter(c.Writer)
+	for _, file := range files {
+		w, err := archive.Create(file.name)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.value); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		c.Error(err)
+	}
+}
+
+// Запрос на удаление собственного аккаунта. Данные обезличиваются после
+// периода ожидания, в течение которого удаление можно отменить.
+func (h *UserHandler) DeleteAccount(c *gin.Context) {
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetInt64("userID")
+
+	if req.Password == "" {
+		h.requestDeletionConfirmation(c, userID)
+		return
+	}
+
+	var password string
+	err := h.DB.Get(&password, "SELECT password FROM users WHERE id = $1 AND deleted_at IS NULL", userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if !auth.CheckPassword(req.Password, password) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный пароль"})
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	defer tx.Rollback()
+
+	h.scheduleDeletion(c, tx, userID)
+}
+
+// Отправляет ссылку для подтверждения удаления на email пользователя
+func (h *UserHandler) requestDeletionConfirmation(c *gin.Context, userID int64) {
+	var email string
+	err := h.DB.Get(&email, "SELECT email FROM users WHERE id = $1 AND deleted_at IS NULL", userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	token, hash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка генерации токена"})
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Действует только последняя ссылка
+	_, err = tx.Exec("UPDATE account_deletion_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	_, err = tx.Exec("INSERT INTO account_deletion_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3)",
+		userID, hash, time.Now().Add(accountDeletionTTL))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	err = mailer.Enqueue(tx, mailer.Message{
+		To:      email,
+		Subject: "Подтверждение удаления аккаунта",
+		Body: "Для подтверждения удаления аккаунта перейдите по ссылке:\n" +
+			h.AppURL + "/?delete_token=" + url.QueryEscape(token) + "\n\n" +
+			"Ссылка действительна в течение часа. Если вы не запрашивали удаление, проигнорируйте это письмо и смените пароль.",
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка отправки письма"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":           "На email отправлена ссылка для подтверждения удаления аккаунта",
+		"confirmation_sent": true,
+	})
+}
+
+// Подтверждение удаления аккаунта по токену из письма
+func (h *UserHandler) ConfirmAccountDeletion(c *gin.Context) {
+	var req ConfirmAccountDeletionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	err = tx.Get(&userID,
+		"UPDATE account_deletion_tokens SET used_at = NOW() WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW() RETURNING user_id",
+		auth.HashToken(req.Token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Ссылка для удаления аккаунта недействительна или устарела"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	h.scheduleDeletion(c, tx, userID)
+}
+
+// Планирует удаление подтвержденного аккаунта, уведомляет по email и фиксирует транзакцию
+func (h *UserHandler) scheduleDeletion(c *gin.Context, tx *sqlx.Tx, userID int64) {
+	// Блокируем строки суперадминов, как при смене роли
+	var superAdmins []int64
+	if err := tx.Select(&superAdmins, "SELECT id FROM users WHERE role = $1 AND deletion_scheduled_at IS NULL AND deleted_at IS NULL FOR UPDATE", models.RoleSuperAdmin); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	var user struct {
+		Email               string      `db:"email"`
+		Role                models.Role `db:"role"`
+		DeletionScheduledAt *time.Time  `db:"deletion_scheduled_at"`
+	}
+	err := tx.Get(&user, "SELECT email, role, deletion_scheduled_at FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if user.DeletionScheduledAt != nil {
+		// Использованный токен все равно фиксируем
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Удаление аккаунта уже запланировано", "deletion_scheduled_at": user.DeletionScheduledAt})
+		return
+	}
+
+	if user.Role == models.RoleSuperAdmin && len(superAdmins) <= 1 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Нельзя удалить последнего суперадмина"})
+		return
+	}
+
+	scheduledAt := time.Now().Add(h.DeletionGrace)
+	_, err = tx.Exec("UPDATE users SET deletion_scheduled_at = $1, updated_at = NOW() WHERE id = $2", scheduledAt, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	err = mailer.Enqueue(tx, mailer.Message{
+		To:      user.Email,
+		Subject: "Удаление аккаунта",
+		Body: "Ваш аккаунт будет удален " + scheduledAt.Format("02.01.2006 15:04") + ".\n\n" +
+			"До этого момента удаление можно отменить в профиле: " + h.AppURL + "\n" +
+			"Если вы не запрашивали удаление, отмените его и смените пароль.",
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка отправки письма"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":               "Аккаунт будет удален по истечении периода ожидания",
+		"deletion_scheduled_at": scheduledAt,
+	})
+}
+
+// Отмена запланированного удаления аккаунта
+func (h *UserHandler) CancelAccountDeletion(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	result, err := h.DB.Exec(
+		"UPDATE users SET deletion_scheduled_at = NULL, updated_at = NOW() WHERE id = $1 AND deletion_scheduled_at IS NOT NULL AND anonymized_at IS NULL",
+		userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Удаление аккаунта не запланировано"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Удаление аккаунта отменено"})
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"mango/internal/auth"
+	"mango/internal/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+type APIKeyHandler struct {
+	DB     *sqlx.DB
+	States *auth.UserStates
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string              `json:"name" binding:"required,min=1,max=100"`
+	Scopes    []models.Permission `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time          `json:"expires_at"`
+}
+
+type APIKeyInfo struct {
+	models.APIKey
+	Owner string `db:"owner" json:"owner"`
+}
+
+// Создание API-ключа (только для админов)
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Срок действия ключа должен быть в будущем"})
+		return
+	}
+
+	userID := c.GetInt64("userID")
+	userRole := c.MustGet("userRole").(models.Role)
+
+	// Ключ не может получить больше прав, чем есть у создателя
+	scopes := models.StringArray{}
+	for _, scope := range req.Scopes {
+		if _, ok := models.Permissions[scope]; !ok || scope == models.PermissionAll {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неизвестное право доступа: " + string(scope)})
+			return
+		}
+
+		allowed, err := h.States.HasPermission(userRole, scope)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Недостаточно прав для выдачи права " + string(scope)})
+			return
+		}
+
+		scopes = append(scopes, string(scope))
+	}
+
+	key, prefix, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка генерации ключа"})
+		return
+	}
+
+	var keyID int64
+	err = h.DB.Get(&keyID,
+		"INSERT INTO api_keys (name, prefix, key_hash, scopes, user_id, expires_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+		req.Name, prefix, hash, scopes, userID, req.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания ключа"})
+		return
+	}
+
+	// Ключ показывается только один раз
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "API-ключ создан. Сохраните его, повторно он показан не будет",
+		"id":      keyID,
+		"key":     key,
+		"prefix":  prefix,
+	})
+}
+
+// Получение списка API-ключей (только для админов)
+func (h *APIKeyHandler) GetAPIKeys(c *gin.Context) {
+	var keys []APIKeyInfo
+	err := h.DB.Select(&keys,
+		`SELECT k.id, k.name, k.prefix, k.scopes, k.user_id, k.expires_at, k.last_used_at, k.revoked_at, k.created_at, u.username AS owner
+         FROM api_keys k JOIN users u ON u.id = k.user_id
+         ORDER BY k.revoked_at IS NOT NULL, k.created_at DESC`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения ключей"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+// Отзыв API-ключа (только для админов)
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	keyID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID ключа"})
+		return
+	}
+
+	result, err := h.DB.Exec("UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL", keyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка отзыва ключа"})
+		return
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ключ не найден или уже отозван"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API-ключ отозван"})
+}
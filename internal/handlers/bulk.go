@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"mango/internal/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// Максимальное число объектов в одной массовой операции
+const bulkMaxItems = 1000
+
+// Итог обработки одного объекта
+const (
+	bulkChanged   = "changed"
+	bulkUnchanged = "unchanged"
+	bulkSkipped   = "skipped"
+	bulkNotFound  = "not_found"
+)
+
+type BulkResult struct {
+	ID      int64  `json:"id"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+type BulkUsersRequest struct {
+	IDs    []int64     `json:"ids"`
+	Filter *UserFilter `json:"filter"`
+	Reason string      `json:"reason" binding:"max=500"`
+	Until  *time.Time  `json:"until"`
+	DryRun bool        `json:"dry_run"`
+}
+
+type BulkMangaRequest struct {
+	IDs    []int64      `json:"ids"`
+	Filter *MangaFilter `json:"filter"`
+	DryRun bool         `json:"dry_run"`
+}
+
+// bulkReport собирает результаты по объектам и сводку по статусам
+type bulkReport struct {
+	action  string
+	dryRun  bool
+	results []BulkResult
+	summary map[string]int
+}
+
+func newBulkReport(action string, dryRun bool) *bulkReport {
+	return &bulkReport{
+		action:  action,
+		dryRun:  dryRun,
+		results: []BulkResult{},
+		summary: map[string]int{bulkChanged: 0, bulkUnchanged: 0, bulkSkipped: 0, bulkNotFound: 0},
+	}
+}
+
+func (r *bulkReport) add(id int64, status, message string) {
+	r.results = append(r.results, BulkResult{ID: id, Status: status, Message: message})
+	r.summary[status]++
+}
+
+func (r *bulkReport) response() gin.H {
+	return gin.H{
+		"action":  r.action,
+		"dry_run": r.dryRun,
+		"summary": r.summary,
+		"results": r.results,
+	}
+}
+
+var (
+	errBulkTargets  = errors.New("Укажите либо ids, либо filter")
+	errBulkTooLarge = errors.New("Слишком много объектов для одной операции (максимум " + strconv.Itoa(bulkMaxItems) + "), уточните фильтр")
+)
+
+// Возвращает ID объектов операции: переданный список без повторов или выборку по условию
+func bulkTargets(q sqlx.Queryer, ids []int64, table, where string, args []interface{}) ([]int64, error) {
+	if len(ids) > 0 {
+		if len(ids) > bulkMaxItems {
+			return nil, errBulkTooLarge
+		}
+
+		seen := make(map[int64]bool, len(ids))
+		unique := make([]int64, 0, len(ids))
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				unique = append(unique, id)
+			}
+		}
+		return unique, nil
+	}
+
+	var found []int64
+	query := "SELECT id FROM " + table + " WHERE " + where + " ORDER BY id LIMIT " + strconv.Itoa(bulkMaxItems+1)
+	if err := sqlx.Select(q, &found, query, args...); err != nil {
+		return nil, err
+	}
+	if len(found) > bulkMaxItems {
+		return nil, errBulkTooLarge
+	}
+	return found, nil
+}
+
+// Массовые действия над пользователями: block, unblock, delete, restore (только для админов).
+// Все изменения выполняются в одной транзакции; при dry_run транзакция откатывается,
+// а в ответе остается отчет о том, что было бы изменено.
+func (h *UserHandler) BulkUsers(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req BulkUsersRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if (len(req.IDs) > 0) == (req.Filter != nil) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errBulkTargets.Error()})
+			return
+		}
+		if action == "block" && req.Until != nil && !req.Until.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Срок блокировки должен быть в будущем"})
+			return
+		}
+
+		var where string
+		var args []interface{}
+		if req.Filter != nil {
+			var err error
+			where, args, err = req.Filter.where(1)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		tx, err := h.DB.Beginx()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+			return
+		}
+		defer tx.Rollback()
+
+		ids, err := bulkTargets(tx, req.IDs, "users", where, args)
+		if err != nil {
+			if err == errBulkTooLarge {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+			return
+		}
+
+		actorID := c.GetInt64("userID")
+		report := newBulkReport(action, req.DryRun)
+		var changed, revoked []int64
+
+		for _, id := range ids {
+			status, message, sessions, err := h.bulkUserAction(tx, action, id, actorID, req)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+				return
+			}
+			report.add(id, status, message)
+			if status == bulkChanged {
+				changed = append(changed, id)
+			}
+			revoked = append(revoked, sessions...)
+		}
+
+		if !req.DryRun {
+			if err := tx.Commit(); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+				return
+			}
+			for _, id := range changed {
+				h.States.Invalidate(id)
+			}
+			h.States.InvalidateSessions(revoked...)
+		}
+
+		c.JSON(http.StatusOK, report.response())
+	}
+}
+
+// Применяет действие к одному пользователю и возвращает итог и завершенные сессии
+func (h *UserHandler) bulkUserAction(tx *sqlx.Tx, action string, id, actorID int64, req BulkUsersRequest) (string, string, []int64, error) {
+	var user struct {
+		Role       models.Role `db:"role"`
+		IsBlocked  bool        `db:"is_blocked"`
+		Deleted    bool        `db:"deleted"`
+		Anonymized bool        `db:"anonymized"`
+	}
+	err := tx.Get(&user,
+		"SELECT role, "+models.IsBlockedSQL+", deleted_at IS NOT NULL AS deleted, anonymized_at IS NOT NULL AS anonymized FROM users WHERE id = $1 FOR UPDATE",
+		id)
+	if err == sql.ErrNoRows || (err == nil && user.Anonymized) {
+		return bulkNotFound, "Пользователь не найден", nil, nil
+	}
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	if action == "restore" {
+		if !user.Deleted {
+			return bulkUnchanged, "Пользователь не удален", nil, nil
+		}
+		_, err = tx.Exec("UPDATE users SET deleted_at = NULL, deleted_by = NULL, updated_at = NOW() WHERE id = $1", id)
+		return bulkChanged, "", nil, err
+	}
+
+	if user.Deleted {
+		return bulkNotFound, "Пользователь удален", nil, nil
+	}
+	if id == actorID {
+		return bulkSkipped, "Нельзя применить действие к себе", nil, nil
+	}
+
+	switch action {
+	case "block":
+		if user.Role == models.RoleSuperAdmin {
+			return bulkSkipped, "Нельзя заблокировать суперадмина", nil, nil
+		}
+		if user.IsBlocked {
+			return bulkUnchanged, "Пользователь уже заблокирован", nil, nil
+		}
+
+		var reason *string
+		if req.Reason != "" {
+			reason = &req.Reason
+		}
+		_, err = tx.Exec(
+			"UPDATE users SET is_blocked = true, blocked_reason = $1, blocked_until = $2, blocked_at = NOW(), blocked_by = $3, updated_at = NOW() WHERE id = $4",
+			reason, utcTime(req.Until), actorID, id)
+		return bulkChanged, "", nil, err
+
+	case "unblock":
+		if !user.IsBlocked {
+			return bulkUnchanged, "Пользователь не заблокирован", nil, nil
+		}
+		_, err = tx.Exec(
+			"UPDATE users SET is_blocked = false, blocked_reason = NULL, blocked_until = NULL, blocked_at = NULL, blocked_by = NULL, updated_at = NOW() WHERE id = $1",
+			id)
+		return bulkChanged, "", nil, err
+
+	case "delete":
+		if user.Role == models.RoleSuperAdmin {
+			return bulkSkipped, "Нельзя удалить суперадмина", nil, nil
+		}
+		_, err = tx.Exec("UPDATE users SET deleted_at = NOW(), deleted_by = $1, updated_at = NOW() WHERE id = $2", actorID, id)
+		if err != nil {
+			return "", "", nil, err
+		}
+		revoked, err := revokeUserSessions(tx, id, 0)
+		return bulkChanged, "", revoked, err
+	}
+
+	return "", "", nil, errors.New("неизвестное действие " + action)
+}
+
+// Массовые действия над мангой: activate, deactivate (только для админов)
+func (h *MangaHandler) BulkManga(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req BulkMangaRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if (len(req.IDs) > 0) == (req.Filter != nil) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errBulkTargets.Error()})
+			return
+		}
+
+		var where string
+		var args []interface{}
+		if req.Filter != nil {
+			var err error
+			where, args, err = req.Filter.where("")
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		tx, err := h.DB.Beginx()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+			return
+		}
+		defer tx.Rollback()
+
+		ids, err := bulkTargets(tx, req.IDs, "manga", where, args)
+		if err != nil {
+			if err == errBulkTooLarge {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+			return
+		}
+
+		activate := action == "activate"
+		report := newBulkReport(action, req.DryRun)
+
+		for _, id := range ids {
+			var isActive bool
+			err := tx.Get(&isActive, "SELECT is_active FROM manga WHERE id = $1 FOR UPDATE", id)
+			if err == sql.ErrNoRows {
+				report.add(id, bulkNotFound, "Манга не найдена")
+				continue
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+				return
+			}
+
+			if isActive == activate {
+				report.add(id, bulkUnchanged, "")
+				continue
+			}
+
+			if _, err := tx.Exec("UPDATE manga SET is_active = $1, updated_at = NOW() WHERE id = $2", activate, id); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+				return
+			}
+			report.add(id, bulkChanged, "")
+		}
+
+		if !req.DryRun {
+			if err := tx.Commit(); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, report.response())
+	}
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"database/sql"
+	"mango/internal/auth"
+	"mango/internal/mailer"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// Ограничения на повторную отправку письма подтверждения
+const (
+	emailVerificationTTL       = 48 * time.Hour
+	verificationResendCooldown = time.Minute
+	verificationHourlyLimit    = 5
+)
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// Создает токен подтверждения и ставит письмо в очередь
+func (h *UserHandler) sendVerificationEmail(tx *sqlx.Tx, userID int64, email string) error {
+	token, hash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	// Прежние ссылки перестают действовать
+	_, err = tx.Exec("UPDATE email_verification_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL", userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO email_verification_tokens (user_id, email, token_hash, expires_at) VALUES ($1, $2, $3, $4)",
+		userID, email, hash, time.Now().Add(emailVerificationTTL))
+	if err != nil {
+		return err
+	}
+
+	return mailer.Enqueue(tx, mailer.Message{
+		To:      email,
+		Subject: "Подтверждение email",
+		Body: "Для подтверждения адреса электронной почты перейдите по ссылке:\n" +
+			h.AppURL + "/?verify_token=" + url.QueryEscape(token) + "\n\n" +
+			"Ссылка действительна в течение 48 часов.",
+	})
+}
+
+// Подтверждение email по токену из письма
+func (h *UserHandler) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	defer tx.Rollback()
+
+	var verification struct {
+		ID     int64  `db:"id"`
+		UserID int64  `db:"user_id"`
+		Email  string `db:"email"`
+	}
+	err = tx.Get(&verification,
+		"SELECT id, user_id, email FROM email_verification_tokens WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW() FOR UPDATE",
+		auth.HashToken(req.Token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Ссылка для подтверждения недействительна или устарела"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	// Подтверждаем только если email с момента отправки не менялся
+	result, err := tx.Exec(
+		"UPDATE users SET email_verified = true, email_verified_at = NOW(), updated_at = NOW() WHERE id = $1 AND email = $2",
+		verification.UserID, verification.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка подтверждения email"})
+		return
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ссылка для подтверждения недействительна или устарела"})
+		return
+	}
+
+	_, err = tx.Exec("UPDATE email_verification_tokens SET used_at = NOW() WHERE id = $1", verification.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	h.States.Invalidate(verification.UserID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email успешно подтвержден"})
+}
+
+// Повторная отправка письма подтверждения
+func (h *UserHandler) ResendVerification(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	var user struct {
+		Email         string `db:"email"`
+		EmailVerified bool   `db:"email_verified"`
+	}
+	err := h.DB.Get(&user, "SELECT email, email_verified FROM users WHERE id = $1", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if user.EmailVerified {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email уже подтвержден"})
+		return
+	}
+
+	// Ограничиваем частоту отправки
+	var stats struct {
+		LastSent *time.Time `db:"last_sent"`
+		SentHour int        `db:"sent_hour"`
+	}
+	err = h.DB.Get(&stats,
+		`SELECT MAX(created_at) AS last_sent, COUNT(*) FILTER (WHERE created_at > NOW() - INTERVAL '1 hour') AS sent_hour
+         FROM email_verification_tokens WHERE user_id = $1`,
+		userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if stats.SentHour >= verificationHourlyLimit {
+		c.Header("Retry-After", strconv.Itoa(int(time.Hour.Seconds())))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Слишком много запросов, попробуйте позже"})
+		return
+	}
+
+	if stats.LastSent != nil {
+		if wait := time.Until(stats.LastSent.Add(verificationResendCooldown)); wait > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Письмо уже отправлено, попробуйте позже"})
+			return
+		}
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := h.sendVerificationEmail(tx, userID, user.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка отправки письма"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Письмо для подтверждения отправлено"})
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"database/sql"
+	"mango/internal/auth"
+	"mango/internal/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+type ImpersonationHandler struct {
+	DB     *sqlx.DB
+	States *auth.UserStates
+}
+
+type ImpersonateRequest struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+type ImpersonationRequestLog struct {
+	ID        int64  `db:"id" json:"id"`
+	SessionID int64  `db:"session_id" json:"session_id"`
+	ActorID   *int64 `db:"actor_id" json:"actor_id"`
+	TargetID  *int64 `db:"target_id" json:"target_id"`
+	Method    string `db:"method" json:"method"`
+	Path      string `db:"path" json:"path"`
+	Status    int    `db:"status" json:"status"`
+	IP        string `db:"ip" json:"ip"`
+	CreatedAt string `db:"created_at" json:"created_at"`
+}
+
+type ImpersonationSession struct {
+	ID             int64   `db:"id" json:"id"`
+	ActorID        *int64  `db:"actor_id" json:"actor_id"`
+	ActorUsername  *string `db:"actor_username" json:"actor_username"`
+	TargetID       *int64  `db:"target_id" json:"target_id"`
+	TargetUsername *string `db:"target_username" json:"target_username"`
+	Reason         string  `db:"reason" json:"reason"`
+	ExpiresAt      string  `db:"expires_at" json:"expires_at"`
+	EndedAt        *string `db:"ended_at" json:"ended_at"`
+	EndedBy        *int64  `db:"ended_by" json:"ended_by"`
+	CreatedAt      string  `db:"created_at" json:"created_at"`
+}
+
+// Выпуск токена для входа от имени пользователя
+func (h *ImpersonationHandler) Impersonate(c *gin.Context) {
+	targetID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID пользователя"})
+		return
+	}
+
+	var req ImpersonateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	actorID := c.GetInt64("userID")
+
+	// Повторная имперсонация из-под чужого токена запрещена
+	if _, impersonating := c.Get("impersonatorID"); impersonating {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Действие недоступно в режиме входа от имени пользователя"})
+		return
+	}
+
+	if targetID == actorID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Нельзя войти от имени самого себя"})
+		return
+	}
+
+	var target models.User
+	err = h.DB.Get(&target, "SELECT id, username, role, "+models.IsBlockedSQL+", token_version FROM users WHERE id = $1 AND deleted_at IS NULL", targetID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if target.Role == models.RoleSuperAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Нельзя войти от имени суперадмина"})
+		return
+	}
+
+	var sessionID int64
+	err = h.DB.Get(&sessionID,
+		"INSERT INTO impersonation_sessions (actor_id, target_id, reason, expires_at) VALUES ($1, $2, $3, $4) RETURNING id",
+		actorID, targetID, req.Reason, time.Now().Add(auth.ImpersonationTokenTTL))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	token, err := auth.GenerateImpersonationToken(target, actorID, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка генерации токена"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         token,
+		"expires_in":    int(auth.ImpersonationTokenTTL.Seconds()),
+		"session_id":    sessionID,
+		"impersonating": true,
+		"user": gin.H{
+			"id":       target.ID,
+			"username": target.Username,
+			"role":     target.Role,
+		},
+	})
+}
+
+// Досрочное завершение сессии имперсонации суперадмином
+func (h *ImpersonationHandler) EndImpersonation(c *gin.Context) {
+	sessionID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID сессии"})
+		return
+	}
+
+	h.endSession(c, sessionID, c.GetInt64("userID"))
+}
+
+// Выход из режима входа от имени пользователя по токену имперсонации
+func (h *ImpersonationHandler) StopImpersonation(c *gin.Context) {
+	sessionID, impersonating := c.Get("impersonationSessionID")
+	if !impersonating {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Вход от имени пользователя не выполнен"})
+		return
+	}
+
+	h.endSession(c, sessionID.(int64), c.GetInt64("impersonatorID"))
+}
+
+func (h *ImpersonationHandler) endSession(c *gin.Context, sessionID, endedBy int64) {
+	result, err := h.DB.Exec(
+		"UPDATE impersonation_sessions SET ended_at = NOW(), ended_by = $1 WHERE id = $2 AND ended_at IS NULL AND expires_at > NOW()",
+		endedBy, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Сессия не найдена или уже завершена"})
+		return
+	}
+	h.States.InvalidateImpersonation(sessionID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Сессия имперсонации завершена"})
+}
+
+// Список сессий имперсонации с указанной причиной входа; active=true - только действующие
+func (h *ImpersonationHandler) GetImpersonationSessions(c *gin.Context) {
+	condition := "TRUE"
+	if c.Query("active") == "true" {
+		condition = "s.ended_at IS NULL AND s.expires_at > NOW()"
+	}
+
+	sessions := []ImpersonationSession{}
+	err := h.DB.Select(&sessions,
+		`SELECT s.id, s.actor_id, a.username AS actor_username, s.target_id, t.username AS target_username,
+                s.reason, s.expires_at, s.ended_at, s.ended_by, s.created_at
+         FROM impersonation_sessions s
+         LEFT JOIN users a ON a.id = s.actor_id
+         LEFT JOIN users t ON t.id = s.target_id
+         WHERE `+condition+` ORDER BY s.created_at DESC LIMIT 500`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения сессий"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// Журнал запросов, выполненных от имени пользователей
+func (h *ImpersonationHandler) GetImpersonationLog(c *gin.Context) {
+	query := "SELECT id, session_id, actor_id, target_id, method, path, status, ip, created_at FROM impersonation_requests"
+	args := []interface{}{}
+
+	if sessionIDStr := c.Query("session_id"); sessionIDStr != "" {
+		sessionID, err := strconv.ParseInt(sessionIDStr, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID сессии"})
+			return
+		}
+		query += " WHERE session_id = $1"
+		args = append(args, sessionID)
+	}
+
+	query += " ORDER BY created_at DESC LIMIT 500"
+
+	var requests []ImpersonationRequestLog
+	if err := h.DB.Select(&requests, query, args...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения журнала"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"requests": requests})
+}
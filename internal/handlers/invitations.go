@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"database/sql"
+	"mango/internal/auth"
+	"mango/internal/mailer"
+	"mango/internal/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// Срок действия приглашения по умолчанию и максимальный
+const (
+	invitationDefaultTTL = 72 * time.Hour
+	invitationMaxTTL     = 30 * 24 * time.Hour
+)
+
+type InvitationHandler struct {
+	DB     *sqlx.DB
+	States *auth.UserStates
+	AppURL string
+}
+
+type CreateInvitationRequest struct {
+	Email          string      `json:"email" binding:"required,email"`
+	Role           models.Role `json:"role" binding:"required"`
+	ExpiresInHours int         `json:"expires_in_hours" binding:"min=0"`
+}
+
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Username string `json:"username" binding:"required,min=3,max=50"`
+	Password string `json:"password" binding:"required"`
+}
+
+// Создание приглашения (только для админов)
+func (h *InvitationHandler) CreateInvitation(c *gin.Context) {
+	var req CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ttl := invitationDefaultTTL
+	if req.ExpiresInHours > 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+	if ttl > invitationMaxTTL {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Срок действия приглашения не может превышать 30 дней"})
+		return
+	}
+
+	var roleExists bool
+	if err := h.DB.Get(&roleExists, "SELECT EXISTS(SELECT 1 FROM roles WHERE name = $1)", req.Role); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	if !roleExists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Роль не найдена"})
+		return
+	}
+
+	// Приглашение не может дать больше прав, чем есть у приглашающего
+	var permissions []models.Permission
+	if err := h.DB.Select(&permissions, "SELECT permission FROM role_permissions WHERE role = $1", req.Role); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	inviterRole := c.MustGet("userRole").(models.Role)
+	if req.Role == models.RoleSuperAdmin && inviterRole != models.RoleSuperAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Пригласить суперадмина может только суперадмин"})
+		return
+	}
+	for _, permission := range permissions {
+		allowed, err := h.States.HasPermission(inviterRole, permission)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Недостаточно прав для приглашения с ролью " + string(req.Role)})
+			return
+		}
+	}
+
+	var exists bool
+	if err := h.DB.Get(&exists, "SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(email) = LOWER($1))", req.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "Пользователь с таким email уже существует"})
+		return
+	}
+
+	token, hash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка генерации токена"})
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Прежние приглашения на этот email перестают действовать
+	_, err = tx.Exec(
+		"UPDATE invitations SET revoked_at = NOW() WHERE LOWER(email) = LOWER($1) AND accepted_at IS NULL AND revoked_at IS NULL",
+		req.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	var invitation models.Invitation
+	err = tx.Get(&invitation,
+		`INSERT INTO invitations (email, role, token_hash, invited_by, expires_at) VALUES ($1, $2, $3, $4, $5)
+         RETURNING id, email, role, invited_by, expires_at, accepted_at, accepted_user_id, revoked_at, created_at`,
+		req.Email, req.Role, hash, c.GetInt64("userID"), time.Now().Add(ttl))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания приглашения"})
+		return
+	}
+
+	inviteURL := h.AppURL + "/?invite_token=" + url.QueryEscape(token)
+	err = mailer.Enqueue(tx, mailer.Message{
+		To:      req.Email,
+		Subject: "Приглашение в Mango",
+		Body: "Вас пригласили в Mango с ролью " + string(req.Role) + ".\n\n" +
+			"Чтобы создать аккаунт, перейдите по ссылке:\n" + inviteURL + "\n\n" +
+			"Ссылка действительна до " + invitation.ExpiresAt.Format("02.01.2006 15:04") + " и может быть использована один раз.",
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка отправки письма"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания приглашения"})
+		return
+	}
+
+	// Ссылка уходит только на приглашенный адрес: аккаунт создается с подтвержденным email,
+	// поэтому владеть ею должен лишь получатель письма, но не приглашающий
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "Приглашение отправлено",
+		"invitation": invitation,
+	})
+}
+
+// Список приглашений (только для админов). По умолчанию - только ожидающие, status=all - все.
+func (h *InvitationHandler) GetInvitations(c *gin.Context) {
+	condition := "i.accepted_at IS NULL AND i.revoked_at IS NULL AND i.expires_at > NOW()"
+	if c.Query("status") == "all" {
+		condition = "TRUE"
+	}
+
+	invitations := []models.Invitation{}
+	err := h.DB.Select(&invitations,
+		`SELECT i.id, i.email, i.role, i.invited_by, u.username AS invited_by_name, i.expires_at,
+                i.accepted_at, i.accepted_user_id, i.revoked_at, i.created_at
+         FROM invitations i LEFT JOIN users u ON u.id = i.invited_by
+         WHERE `+condition+` ORDER BY i.created_at DESC`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения приглашений"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invitations": invitations})
+}
+
+// Отзыв приглашения (только для админов)
+func (h *InvitationHandler) RevokeInvitation(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID приглашения"})
+		return
+	}
+
+	result, err := h.DB.Exec("UPDATE invitations SET revoked_at = NOW() WHERE id = $1 AND accepted_at IS NULL AND revoked_at IS NULL", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка отзыва приглашения"})
+		return
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Действующее приглашение не найдено"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Приглашение отозвано"})
+}
+
+// Регистрация по приглашению: email и роль берутся из приглашения
+func (h *UserHandler) AcceptInvitation(c *gin.Context) {
+	var req AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	defer tx.Rollback()
+
+	var invitation struct {
+		ID    int64       `db:"id"`
+		Email string      `db:"email"`
+		Role  models.Role `db:"role"`
+	}
+	err = tx.Get(&invitation,
+		`SELECT id, email, role FROM invitations
+         WHERE token_hash = $1 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW() FOR UPDATE`,
+		auth.HashToken(req.Token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Приглашение недействительно или устарело"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	var exists bool
+	err = tx.Get(&exists, "SELECT EXISTS(SELECT 1 FROM users WHERE username = $1 OR LOWER(email) = LOWER($2))", req.Username, invitation.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "Пользователь с таким именем или email уже существует"})
+		return
+	}
+
+	if !h.acceptPassword(c, req.Password, req.Username, invitation.Email) {
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка хеширования пароля"})
+		return
+	}
+
+	// Переход по ссылке из письма подтверждает email
+	var userID int64
+	err = tx.Get(&userID,
+		"INSERT INTO users (username, email, password, role, email_verified, email_verified_at) VALUES ($1, $2, $3, $4, TRUE, NOW()) RETURNING id",
+		req.Username, invitation.Email, hashedPassword, invitation.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания пользователя"})
+		return
+	}
+
+	_, err = tx.Exec("UPDATE invitations SET accepted_at = NOW(), accepted_user_id = $1 WHERE id = $2", userID, invitation.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания пользователя"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания пользователя"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Аккаунт создан, теперь можно войти",
+		"user_id": userID,
+		"role":    invitation.Role,
+	})
+}
@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"mango/internal/auth"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Публичные ключи проверки JWT для других сервисов
+func JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, auth.Keys.JWKS())
+}
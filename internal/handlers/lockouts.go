@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"mango/internal/auth"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LoginLockout struct {
+	Scope         string     `db:"scope" json:"scope"`
+	Key           string     `db:"key" json:"key"`
+	Failures      int        `db:"failures" json:"failures"`
+	LastFailureAt time.Time  `db:"last_failure_at" json:"last_failure_at"`
+	LockedUntil   *time.Time `db:"locked_until" json:"locked_until"`
+}
+
+// Получение списка ограничений входа (только для админов)
+func (h *UserHandler) GetLockouts(c *gin.Context) {
+	var lockouts []LoginLockout
+	err := h.DB.Select(&lockouts,
+		`SELECT scope, key, failures, last_failure_at, locked_until FROM login_throttles
+         WHERE locked_until > NOW() OR last_failure_at > NOW() - $1 * INTERVAL '1 second'
+         ORDER BY locked_until DESC NULLS LAST, last_failure_at DESC`,
+		h.Throttle.Window.Seconds())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения блокировок"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lockouts": lockouts})
+}
+
+// Снятие ограничения входа (только для админов)
+func (h *UserHandler) ClearLockout(c *gin.Context) {
+	scope := c.Param("scope")
+	key := c.Param("key")
+
+	if scope != auth.ThrottleScopeUsername && scope != auth.ThrottleScopeIP {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный тип блокировки"})
+		return
+	}
+	if scope == auth.ThrottleScopeUsername {
+		key = auth.NormalizeUsername(key)
+	}
+
+	result, err := h.DB.Exec("DELETE FROM login_throttles WHERE scope = $1 AND key = $2", scope, key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка снятия блокировки"})
+		return
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Блокировка не найдена"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Блокировка снята"})
+}
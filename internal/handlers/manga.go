@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"database/sql"
+	"fmt"
 	"mango/internal/models"
 	"net/http"
 	"strconv"
@@ -48,9 +49,6 @@ type UpdateMangaRequest struct {
 func (h *MangaHandler) GetAllManga(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
-	search := c.Query("search")
-	author := c.Query("author")
-	status := c.Query("status")
 
 	if page < 1 {
 		page = 1
@@ -61,54 +59,72 @@ func (h *MangaHandler) GetAllManga(c *gin.Context) {
 
 	offset := (page - 1) * limit
 
-	// Базовый запрос
-	query := "SELECT id, title, description, author, artist, genres, status, year, chapters, price, cover_image, stock, is_active, created_at, updated_at FROM manga WHERE is_active = true"
-	countQuery := "SELECT COUNT(*) FROM manga WHERE is_active = true"
-	args := []interface{}{}
-	argIndex := 1
-
-	// Добавляем фильтры
-	if search != "" {
-		query += " AND (title ILIKE $" + strconv.Itoa(argIndex) + " OR description ILIKE $" + strconv.Itoa(argIndex) + ")"
-		countQuery += " AND (title ILIKE $" + strconv.Itoa(argIndex) + " OR description ILIKE $" + strconv.Itoa(argIndex) + ")"
-		args = append(args, "%"+search+"%")
-		argIndex++
-	}
-
-	if author != "" {
-		query += " AND author ILIKE $" + strconv.Itoa(argIndex)
-		countQuery += " AND author ILIKE $" + strconv.Itoa(argIndex)
-		args = append(args, "%"+author+"%")
-		argIndex++
+	// Условия отбора: поиск, автор, статус, жанры, год, цена, наличие
+	var filter MangaFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
+	active := true
+	filter.IsActive = &active
 
-	if status != "" {
-		query += " AND status = $" + strconv.Itoa(argIndex)
-		countQuery += " AND status = $" + strconv.Itoa(argIndex)
-		args = append(args, status)
-		argIndex++
+	where, args, err := filter.where("")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
 	// Получаем общее количество
 	var total int
-	err := h.DB.Get(&total, countQuery, args...)
+	err = h.DB.Get(&total, "SELECT COUNT(*) FROM manga WHERE "+where, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка подсчета манги"})
 		return
 	}
 
-	// Добавляем сортировку и пагинацию
-	query += " ORDER BY created_at DESC LIMIT $" + strconv.Itoa(argIndex) + " OFFSET $" + strconv.Itoa(argIndex+1)
+	// Пустой результат поиска дополняем вариантами исправления запроса
+	var suggestions []string
+	if total == 0 && filter.Search != "" {
+		suggestions, err = h.didYouMean(filter.Search)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения подсказок"})
+			return
+		}
+	}
+
+	facets, err := h.mangaFacets(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка подсчета фильтров"})
+		return
+	}
+
+	// Добавляем сортировку и пагинацию; при поиске сначала самые релевантные
+	argIndex := len(args) + 1
+	pageArgs := "LIMIT $" + strconv.Itoa(argIndex) + " OFFSET $" + strconv.Itoa(argIndex+1)
 	args = append(args, limit, offset)
 
-	var manga []models.Manga
-	err = h.DB.Select(&manga, query, args...)
+	var manga interface{}
+	if filter.Search != "" {
+		// Поисковый запрос для ранга и подсветки передается отдельным параметром
+		searchArg := "$" + strconv.Itoa(argIndex+2)
+		args = append(args, filter.Search)
+
+		hits := []models.MangaSearchHit{}
+		err = h.DB.Select(&hits,
+			"SELECT "+mangaColumns+", "+mangaSearchColumns(searchArg)+" FROM manga WHERE "+where+" ORDER BY rank DESC, created_at DESC "+pageArgs,
+			args...)
+		manga = hits
+	} else {
+		list := []models.Manga{}
+		err = h.DB.Select(&list, "SELECT "+mangaColumns+" FROM manga WHERE "+where+" ORDER BY created_at DESC "+pageArgs, args...)
+		manga = list
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения манги"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"manga": manga,
 		"pagination": gin.H{
 			"page":       page,
@@ -116,7 +132,34 @@ func (h *MangaHandler) GetAllManga(c *gin.Context) {
 			"total":      total,
 			"totalPages": (total + limit - 1) / limit,
 		},
-	})
+		"facets": facets,
+	}
+	if suggestions != nil {
+		response["did_you_mean"] = suggestions
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Счетчики для боковой панели фильтров: жанры, статусы и десятилетия.
+// Каждое измерение считается без собственного условия, но с остальными.
+func (h *MangaHandler) mangaFacets(filter MangaFilter) (gin.H, error) {
+	facets := gin.H{}
+	names := map[string]string{facetGenre: "genres", facetStatus: "status", facetYear: "decades"}
+
+	for dimension, query := range mangaFacetQueries {
+		where, args, err := filter.where(dimension)
+		if err != nil {
+			return nil, err
+		}
+
+		counts := []MangaFacet{}
+		if err := h.DB.Select(&counts, fmt.Sprintf(query, where), args...); err != nil {
+			return nil, err
+		}
+		facets[names[dimension]] = counts
+	}
+
+	return facets, nil
 }
 
 // Получить мангу по ID (публично доступно)
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// MangaFilter - условия отбора манги в каталоге и для массовых операций
+type MangaFilter struct {
+	Search    string   `form:"search" json:"search"`
+	Author    string   `form:"author" json:"author"`
+	Status    string   `form:"status" json:"status"`
+	IsActive  *bool    `form:"-" json:"is_active"`
+	Genres    []string `form:"genre" json:"genres"`
+	GenreMode string   `form:"genre_mode" json:"genre_mode"`
+	YearFrom  *int     `form:"year_from" json:"year_from"`
+	YearTo    *int     `form:"year_to" json:"year_to"`
+	PriceMin  *float64 `form:"price_min" json:"price_min"`
+	PriceMax  *float64 `form:"price_max" json:"price_max"`
+	InStock   bool     `form:"in_stock" json:"in_stock"`
+}
+
+// Измерения фасетов; условие по измерению не применяется к счетчикам этого же измерения,
+// чтобы в боковой панели были видны альтернативы уже выбранным значениям
+const (
+	facetGenre  = "genre"
+	facetStatus = "status"
+	facetYear   = "year"
+)
+
+// MangaFacet - значение фильтра и количество манги с ним
+type MangaFacet struct {
+	Value string `db:"value" json:"value"`
+	Count int    `db:"count" json:"count"`
+}
+
+// Жанры можно передать повторяющимся параметром genre или через запятую
+func (f MangaFilter) genres() []string {
+	seen := map[string]bool{}
+	genres := []string{}
+	for _, value := range f.Genres {
+		for _, genre := range strings.Split(value, ",") {
+			genre = strings.TrimSpace(genre)
+			if genre != "" && !seen[genre] {
+				seen[genre] = true
+				genres = append(genres, genre)
+			}
+		}
+	}
+	return genres
+}
+
+// where строит условие WHERE, плейсхолдеры нумеруются с 1; except - измерение фасета,
+// условие по которому пропускается (пустая строка - применять все условия)
+func (f MangaFilter) where(except string) (string, []interface{}, error) {
+	condition := "TRUE"
+	args := []interface{}{}
+	argIndex := 1
+
+	if f.Search != "" {
+		condition += " AND " + mangaSearchCondition("$"+strconv.Itoa(argIndex))
+		args = append(args, f.Search)
+		argIndex++
+	}
+
+	if f.Author != "" {
+		condition += " AND author ILIKE $" + strconv.Itoa(argIndex)
+		args = append(args, "%"+f.Author+"%")
+		argIndex++
+	}
+
+	if f.Status != "" && except != facetStatus {
+		condition += " AND status = $" + strconv.Itoa(argIndex)
+		args = append(args, f.Status)
+		argIndex++
+	}
+
+	if f.IsActive != nil {
+		condition += " AND is_active = $" + strconv.Itoa(argIndex)
+		args = append(args, *f.IsActive)
+		argIndex++
+	}
+
+	// any - хотя бы один из жанров, all - все жанры сразу
+	if genres := f.genres(); len(genres) > 0 && except != facetGenre {
+		operator := "?|"
+		switch f.GenreMode {
+		case "", "any":
+		case "all":
+			operator = "?&"
+		default:
+			return "", nil, errors.New("Неверный genre_mode: ожидается any или all")
+		}
+		condition += " AND genres " + operator + " $" + strconv.Itoa(argIndex) + "::text[]"
+		args = append(args, pq.Array(genres))
+		argIndex++
+	}
+
+	if except != facetYear {
+		if f.YearFrom != nil {
+			condition += " AND year >= $" + strconv.Itoa(argIndex)
+			args = append(args, *f.YearFrom)
+			argIndex++
+		}
+		if f.YearTo != nil {
+			condition += " AND year <= $" + strconv.Itoa(argIndex)
+			args = append(args, *f.YearTo)
+			argIndex++
+		}
+	}
+
+	if f.PriceMin != nil {
+		condition += " AND price >= $" + strconv.Itoa(argIndex)
+		args = append(args, *f.PriceMin)
+		argIndex++
+	}
+	if f.PriceMax != nil {
+		condition += " AND price <= $" + strconv.Itoa(argIndex)
+		args = append(args, *f.PriceMax)
+	}
+
+	if f.InStock {
+		condition += " AND stock > 0"
+	}
+
+	return condition, args, nil
+}
+
+// Запросы счетчиков по измерениям фасетов; %s заменяется условием WHERE
+var mangaFacetQueries = map[string]string{
+	facetGenre: `SELECT g.value, COUNT(*) AS count
+         FROM manga CROSS JOIN jsonb_array_elements_text(manga.genres) AS g(value)
+         WHERE %s GROUP BY g.value ORDER BY count DESC, g.value`,
+	facetStatus: `SELECT status::text AS value, COUNT(*) AS count
+         FROM manga WHERE %s GROUP BY status ORDER BY count DESC, value`,
+	facetYear: `SELECT (year / 10 * 10)::text AS value, COUNT(*) AS count
+         FROM manga WHERE %s AND year > 0 GROUP BY year / 10 * 10 ORDER BY year / 10 * 10`,
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const mangaColumns = "id, title, description, author, artist, genres, status, year, chapters, price, cover_image, stock, is_active, created_at, updated_at"
+
+// Параметры ts_headline для подсветки совпадений в названии и описании
+const mangaHeadlineOptions = `StartSel=<mark>, StopSel=</mark>, MinWords=15, MaxWords=35, MaxFragments=2, FragmentDelimiter=" … "`
+
+// Порог word_similarity для подсказок «возможно, вы имели в виду».
+// Ниже порога оператора <% по умолчанию (0.6), чтобы находить то, что не нашел основной поиск.
+const didYouMeanThreshold = 0.3
+
+const (
+	defaultSuggestLimit = 8
+	maxSuggestLimit     = 20
+	minSuggestQuery     = 2
+)
+
+// MangaSuggestion - вариант автодополнения: название манги или автор
+type MangaSuggestion struct {
+	Type    string `db:"type" json:"type"`
+	Value   string `db:"value" json:"value"`
+	MangaID *int64 `db:"manga_id" json:"manga_id,omitempty"`
+}
+
+// mangaTSQuery возвращает выражение tsquery для поискового запроса в плейсхолдере.
+// Запрос разбирается в русской и английской конфигурациях (стемминг) и в простой,
+// чтобы имена авторов и художников совпадали без искажений.
+func mangaTSQuery(placeholder string) string {
+	return "(websearch_to_tsquery('russian', " + placeholder + ")" +
+		" || websearch_to_tsquery('english', " + placeholder + ")" +
+		" || websearch_to_tsquery('simple', " + placeholder + "))"
+}
+
+// mangaSearchCondition - полнотекстовое совпадение либо нечеткое (pg_trgm) по названию или автору,
+// чтобы запросы с опечатками в романизированных названиях не оставались без результатов
+func mangaSearchCondition(placeholder string) string {
+	return "(search_vector @@ " + mangaTSQuery(placeholder) +
+		" OR " + placeholder + " <% title OR " + placeholder + " <% author)"
+}
+
+// mangaSearchColumns - ранг и подсветка для выборки с поиском
+func mangaSearchColumns(placeholder string) string {
+	tsquery := mangaTSQuery(placeholder)
+	return "ts_rank_cd(search_vector, " + tsquery + ") + word_similarity(" + placeholder + ", title) AS rank" +
+		", ts_headline('russian', title, " + tsquery + ", '" + mangaHeadlineOptions + "') AS title_highlight" +
+		", ts_headline('russian', COALESCE(description, ''), " + tsquery + ", '" + mangaHeadlineOptions + "') AS snippet"
+}
+
+// Экранирует спецсимволы шаблона LIKE
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// Автодополнение поиска: названия и авторы, начинающиеся с введенного текста,
+// затем похожие с учетом опечаток (публично доступно)
+func (h *MangaHandler) SuggestManga(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultSuggestLimit)))
+	if limit < 1 || limit > maxSuggestLimit {
+		limit = defaultSuggestLimit
+	}
+
+	suggestions := []MangaSuggestion{}
+	if len([]rune(query)) < minSuggestQuery {
+		c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+		return
+	}
+
+	err := h.DB.Select(&suggestions,
+		`SELECT type, value, manga_id FROM (
+             SELECT 'title' AS type, title AS value, id AS manga_id,
+                    title ILIKE $2 AS prefix, word_similarity($1, title) AS score
+             FROM manga WHERE is_active = true AND (title ILIKE $3 OR $1 <% title)
+             UNION ALL
+             SELECT DISTINCT ON (author) 'author', author, NULL::integer,
+                    author ILIKE $2, word_similarity($1, author)
+             FROM manga WHERE is_active = true AND (author ILIKE $3 OR $1 <% author)
+         ) s
+         ORDER BY prefix DESC, score DESC, value
+         LIMIT $4`,
+		query, escapeLike(query)+"%", "%"+escapeLike(query)+"%", limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения подсказок"})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=60")
+	c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+}
+
+// Варианты исправления запроса, не давшего результатов: ближайшие названия и авторы.
+// Порог оператора <% снижается только в транзакции, чтобы работали trigram-индексы.
+func (h *MangaHandler) didYouMean(search string) ([]string, error) {
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)", strconv.FormatFloat(didYouMeanThreshold, 'f', -1, 64))
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := []string{}
+	err = tx.Select(&suggestions,
+		`SELECT value FROM (
+             SELECT title AS value, word_similarity($1, title) AS score FROM manga WHERE is_active = true AND $1 <% title
+             UNION ALL
+             SELECT author, word_similarity($1, author) FROM manga WHERE is_active = true AND $1 <% author
+         ) s
+         GROUP BY value
+         ORDER BY MAX(score) DESC, value
+         LIMIT 3`,
+		search)
+	if err != nil {
+		return nil, err
+	}
+
+	return suggestions, tx.Commit()
+}
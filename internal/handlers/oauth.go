@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log"
+	"mango/internal/auth"
+	"mango/internal/models"
+	"mango/internal/oidc"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// Время жизни параметров входа через внешнего провайдера
+const (
+	oauthStateTTL     = 10 * time.Minute
+	oauthLoginCodeTTL = time.Minute
+	oauthStateCookie  = "oauth_state"
+)
+
+var (
+	errOAuthEmailRequired = errors.New("Провайдер не передал email")
+	errOAuthEmailConflict = errors.New("Аккаунт с таким email уже существует. Войдите по паролю")
+	errOAuthInviteOnly    = errors.New("Регистрация доступна только по приглашению")
+)
+
+type OAuthExchangeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// Список настроенных провайдеров входа
+func (h *UserHandler) GetOAuthProviders(c *gin.Context) {
+	names := make([]string, 0, len(h.OIDC))
+	for name := range h.OIDC {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c.JSON(http.StatusOK, gin.H{"providers": names})
+}
+
+// Начало входа через провайдера: сохраняет state и PKCE verifier и перенаправляет к провайдеру
+func (h *UserHandler) OAuthStart(c *gin.Context) {
+	provider, ok := h.OIDC[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Провайдер не найден"})
+		return
+	}
+
+	state, err := auth.RandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка генерации токена"})
+		return
+	}
+	nonce, err := auth.RandomToken(16)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка генерации токена"})
+		return
+	}
+	verifier, err := auth.RandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка генерации токена"})
+		return
+	}
+
+	authURL, err := provider.AuthURL(c.Request.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Printf("oauth %s: %v", provider.Name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Провайдер недоступен"})
+		return
+	}
+
+	_, err = h.DB.Exec(
+		"INSERT INTO oauth_states (state_hash, provider, code_verifier, nonce, expires_at) VALUES ($1, $2, $3, $4, $5)",
+		auth.HashToken(state), provider.Name, verifier, nonce, time.Now().Add(oauthStateTTL))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	// state дублируется в cookie, чтобы callback принимался только в том же браузере
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthStateCookie, state, int(oauthStateTTL.Seconds()), "/api/oauth", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Возврат от провайдера: проверяет state, обменивает код и находит или создает пользователя.
+// Токены в адрес не попадают: фронтенд получает одноразовый код и обменивает его через OAuthExchange.
+func (h *UserHandler) OAuthCallback(c *gin.Context) {
+	provider, ok := h.OIDC[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Провайдер не найден"})
+		return
+	}
+
+	if providerError := c.Query("error"); providerError != "" {
+		h.oauthRedirect(c, "oauth_error", "Вход отменен: "+providerError)
+		return
+	}
+
+	state := c.Query("state")
+	cookie, _ := c.Cookie(oauthStateCookie)
+	c.SetCookie(oauthStateCookie, "", -1, "/api/oauth", "", c.Request.TLS != nil, true)
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookie)) != 1 {
+		h.oauthRedirect(c, "oauth_error", "Недействительный параметр state, попробуйте войти заново")
+		return
+	}
+
+	var stored struct {
+		CodeVerifier string `db:"code_verifier"`
+		Nonce        string `db:"nonce"`
+	}
+	err := h.DB.Get(&stored,
+		"DELETE FROM oauth_states WHERE state_hash = $1 AND provider = $2 AND expires_at > NOW() RETURNING code_verifier, nonce",
+		auth.HashToken(state), provider.Name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			h.oauthRedirect(c, "oauth_error", "Сессия входа истекла, попробуйте войти заново")
+			return
+		}
+		h.oauthRedirect(c, "oauth_error", "Ошибка базы данных")
+		return
+	}
+
+	claims, err := provider.Exchange(c.Request.Context(), c.Query("code"), stored.CodeVerifier, stored.Nonce)
+	if err != nil {
+		log.Printf("oauth %s: %v", provider.Name, err)
+		h.oauthRedirect(c, "oauth_error", "Не удалось подтвердить вход у провайдера")
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		h.oauthRedirect(c, "oauth_error", "Ошибка базы данных")
+		return
+	}
+	defer tx.Rollback()
+
+	userID, err := h.resolveOAuthUser(tx, provider.Name, claims)
+	if err != nil {
+		if err == errOAuthEmailRequired || err == errOAuthEmailConflict || err == errOAuthInviteOnly {
+			h.oauthRedirect(c, "oauth_error", err.Error())
+			return
+		}
+		h.oauthRedirect(c, "oauth_error", "Ошибка базы данных")
+		return
+	}
+
+	code, hash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		h.oauthRedirect(c, "oauth_error", "Ошибка генерации токена")
+		return
+	}
+
+	_, err = tx.Exec("INSERT INTO oauth_login_codes (user_id, code_hash, expires_at) VALUES ($1, $2, $3)",
+		userID, hash, time.Now().Add(oauthLoginCodeTTL))
+	if err != nil || tx.Commit() != nil {
+		h.oauthRedirect(c, "oauth_error", "Ошибка базы данных")
+		return
+	}
+
+	h.oauthRedirect(c, "oauth_code", code)
+}
+
+// Обмен одноразового кода после входа через провайдера на токены
+func (h *UserHandler) OAuthExchange(c *gin.Context) {
+	var req OAuthExchangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var userID int64
+	err := h.DB.Get(&userID,
+		"UPDATE oauth_login_codes SET used_at = NOW() WHERE code_hash = $1 AND used_at IS NULL AND expires_at > NOW() RETURNING user_id",
+		auth.HashToken(req.Code))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Код входа недействителен или истек"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	var user models.User
+	err = h.DB.Get(&user, "SELECT id, username, email, display_name, bio, avatar_url, role, "+models.IsBlockedSQL+", blocked_reason, blocked_until, email_verified, totp_enabled, token_version FROM users WHERE id = $1 AND deleted_at IS NULL", userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Пользователь не найден"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if user.IsBlocked {
+		c.JSON(http.StatusForbidden, blockedResponse(user))
+		return
+	}
+
+	h.finishLogin(c, user)
+}
+
+// Находит пользователя по привязанной учетной записи провайдера, привязывает существующий
+// аккаунт по подтвержденному email или регистрирует нового пользователя
+func (h *UserHandler) resolveOAuthUser(tx *sqlx.Tx, provider string, claims *oidc.Claims) (int64, error) {
+	var userID int64
+	err := tx.Get(&userID,
+		"UPDATE user_identities SET last_login_at = NOW(), email = COALESCE(NULLIF($3, ''), email) WHERE provider = $1 AND subject = $2 RETURNING user_id",
+		provider, claims.Subject, claims.Email)
+	if err == nil {
+		return userID, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	email := strings.TrimSpace(claims.Email)
+	if email == "" {
+		return 0, errOAuthEmailRequired
+	}
+
+	var existing struct {
+		ID            int64 `db:"id"`
+		EmailVerified bool  `db:"email_verified"`
+	}
+	err = tx.Get(&existing, "SELECT id, email_verified FROM users WHERE LOWER(email) = LOWER($1)", email)
+	switch {
+	case err == nil:
+		// Привязываем только если email подтвержден с обеих сторон, иначе владелец
+		// внешней учетной записи мог бы получить доступ к чужому аккаунту
+		if !claims.EmailVerified || !existing.EmailVerified {
+			return 0, errOAuthEmailConflict
+		}
+		userID = existing.ID
+	case err == sql.ErrNoRows:
+		if h.InviteOnly {
+			return 0, errOAuthInviteOnly
+		}
+		userID, err = h.createOAuthUser(tx, email, claims)
+		if err != nil {
+			return 0, err
+		}
+	default:
+		return 0, err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO user_identities (user_id, provider, subject, email, last_login_at) VALUES ($1, $2, $3, $4, NOW())",
+		userID, provider, claims.Subject, email)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// Регистрирует пользователя по данным провайдера. Пароль случайный: войти по паролю
+// можно будет после его сброса через email.
+func (h *UserHandler) createOAuthUser(tx *sqlx.Tx, email string, claims *oidc.Claims) (int64, error) {
+	username, err := uniqueUsername(tx, claims)
+	if err != nil {
+		return 0, err
+	}
+
+	password, err := auth.RandomToken(32)
+	if err != nil {
+		return 0, err
+	}
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		return 0, err
+	}
+
+	var userID int64
+	err = tx.Get(&userID,
+		`INSERT INTO users (username, email, password, role, email_verified, email_verified_at)
+         VALUES ($1, $2, $3, $4, $5, CASE WHEN $5::boolean THEN NOW() END) RETURNING id`,
+		username, email, hashedPassword, models.RoleUser, claims.EmailVerified)
+	if err != nil {
+		return 0, err
+	}
+
+	if !claims.EmailVerified {
+		if err := h.sendVerificationEmail(tx, userID, email); err != nil {
+			return 0, err
+		}
+	}
+
+	return userID, nil
+}
+
+// Подбирает свободное имя пользователя на основе данных провайдера
+func uniqueUsername(tx *sqlx.Tx, claims *oidc.Claims) (string, error) {
+	base := sanitizeUsername(claims.PreferredUsername)
+	if base == "" {
+		base = sanitizeUsername(claims.Name)
+	}
+	if base == "" {
+		base = sanitizeUsername(strings.SplitN(claims.Email, "@", 2)[0])
+	}
+	for len([]rune(base)) < 3 {
+		base += "_"
+	}
+
+	candidate := base
+	for i := 0; i < 5; i++ {
+		var exists bool
+		if err := tx.Get(&exists, "SELECT EXISTS(SELECT 1 FROM users WHERE username = $1)", candidate); err != nil {
+			return "", err
+		}
+		if !exists {
+			return candidate, nil
+		}
+
+		suffix, err := auth.RandomToken(2)
+		if err != nil {
+			return "", err
+		}
+		candidate = base + "_" + suffix
+	}
+
+	return "", errors.New("не удалось подобрать имя пользователя")
+}
+
+func sanitizeUsername(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' || r == '-':
+			b.WriteRune(r)
+		case unicode.IsSpace(r):
+			b.WriteRune('_')
+		}
+	}
+
+	runes := []rune(b.String())
+	if len(runes) > 40 {
+		runes = runes[:40]
+	}
+	return string(runes)
+}
+
+// Возвращает браузер на фронтенд с результатом входа в параметре запроса
+func (h *UserHandler) oauthRedirect(c *gin.Context, key, value string) {
+	c.Redirect(http.StatusFound, h.AppURL+"/?"+key+"="+url.QueryEscape(value))
+}
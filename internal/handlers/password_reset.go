@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"database/sql"
+	"mango/internal/auth"
+	"mango/internal/mailer"
+	"mango/internal/models"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Время жизни токена сброса пароля
+const passwordResetTTL = time.Hour
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// Запрос на восстановление пароля
+func (h *UserHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Ответ одинаковый независимо от наличия пользователя, чтобы не раскрывать email
+	response := gin.H{"message": "Если аккаунт с таким email существует, на него отправлено письмо для сброса пароля"}
+
+	var user struct {
+		ID        int64 `db:"id"`
+		IsBlocked bool  `db:"is_blocked"`
+	}
+	err := h.DB.Get(&user, "SELECT id, "+models.IsBlockedSQL+" FROM users WHERE email = $1 AND deleted_at IS NULL", req.Email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusOK, response)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if user.IsBlocked {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	token, hash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка генерации токена"})
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Действует только последняя ссылка
+	_, err = tx.Exec("UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL", user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	_, err = tx.Exec("INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3)",
+		user.ID, hash, time.Now().Add(passwordResetTTL))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	err = mailer.Enqueue(tx, mailer.Message{
+		To:      req.Email,
+		Subject: "Сброс пароля",
+		Body: "Для сброса пароля перейдите по ссылке:\n" +
+			h.AppURL + "/?reset_token=" + url.QueryEscape(token) + "\n\n" +
+			"Ссылка действительна в течение часа. Если вы не запрашивали сброс, просто проигнорируйте это письмо.",
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка отправки письма"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Сброс пароля по токену из письма
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	defer tx.Rollback()
+
+	var reset struct {
+		ID       int64  `db:"id"`
+		UserID   int64  `db:"user_id"`
+		Username string `db:"username"`
+		Email    string `db:"email"`
+	}
+	err = tx.Get(&reset,
+		`SELECT t.id, t.user_id, u.username, u.email FROM password_reset_tokens t
+         JOIN users u ON u.id = t.user_id
+         WHERE t.token_hash = $1 AND t.used_at IS NULL AND t.expires_at > NOW() FOR UPDATE OF t`,
+		auth.HashToken(req.Token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Ссылка для сброса пароля недействительна или устарела"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if !h.acceptPassword(c, req.NewPassword, reset.Username, reset.Email) {
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка хеширования пароля"})
+		return
+	}
+
+	_, err = tx.Exec("UPDATE users SET password = $1, token_version = token_version + 1, updated_at = NOW() WHERE id = $2",
+		hashedPassword, reset.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления пароля"})
+		return
+	}
+
+	_, err = tx.Exec("UPDATE password_reset_tokens SET used_at = NOW() WHERE id = $1", reset.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	// Завершаем все сессии пользователя
+	revoked, err := revokeUserSessions(tx, reset.UserID, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	h.States.Invalidate(reset.UserID)
+	h.States.InvalidateSessions(revoked...)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Пароль успешно изменен"})
+}
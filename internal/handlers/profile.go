@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"mango/internal/avatar"
+	"mango/internal/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Максимальный размер загружаемого файла аватара
+const maxAvatarUpload = 5 << 20
+
+// Загрузка аватара (multipart, поле avatar)
+func (h *UserHandler) UploadAvatar(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAvatarUpload+1<<10)
+
+	header, err := c.FormFile("avatar")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Файл avatar не передан или больше 5 МБ"})
+		return
+	}
+	if header.Size > maxAvatarUpload {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Размер файла не должен превышать 5 МБ"})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Не удалось прочитать файл"})
+		return
+	}
+	defer file.Close()
+
+	data, err := avatar.Process(file)
+	if err != nil {
+		if err == avatar.ErrUnsupportedFormat || err == avatar.ErrTooLarge || err == avatar.ErrTooSmall {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обработки изображения"})
+		return
+	}
+
+	userID := c.GetInt64("userID")
+	url, err := h.Avatars.Save(userID, data)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сохранения аватара"})
+		return
+	}
+
+	var previous *string
+	err = h.DB.Get(&previous,
+		"UPDATE users u SET avatar_url = $1, updated_at = NOW() FROM users old WHERE u.id = $2 AND old.id = u.id RETURNING old.avatar_url",
+		url, userID)
+	if err != nil {
+		h.Avatars.Remove(url)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сохранения аватара"})
+		return
+	}
+	h.removeAvatar(previous)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Аватар обновлен", "avatar_url": url})
+}
+
+// Удаление аватара
+func (h *UserHandler) DeleteAvatar(c *gin.Context) {
+	var previous *string
+	err := h.DB.Get(&previous,
+		"UPDATE users u SET avatar_url = NULL, updated_at = NOW() FROM users old WHERE u.id = $1 AND old.id = u.id RETURNING old.avatar_url",
+		c.GetInt64("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления аватара"})
+		return
+	}
+	h.removeAvatar(previous)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Аватар удален"})
+}
+
+func (h *UserHandler) removeAvatar(url *string) {
+	if url == nil {
+		return
+	}
+	if err := h.Avatars.Remove(*url); err != nil {
+		log.Printf("Ошибка удаления файла аватара %s: %v", *url, err)
+	}
+}
+
+// Публичный профиль пользователя
+func (h *UserHandler) GetPublicProfile(c *gin.Context) {
+	var profile models.PublicProfile
+	err := h.DB.Get(&profile,
+		"SELECT username, display_name, bio, avatar_url, created_at FROM users WHERE username = $1 AND deleted_at IS NULL",
+		c.Param("username"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"profile": profile})
+}
@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"database/sql"
+	"mango/internal/auth"
+	"mango/internal/models"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+type RoleHandler struct {
+	DB     *sqlx.DB
+	States *auth.UserStates
+}
+
+type CreateRoleRequest struct {
+	Name        string              `json:"name" binding:"required,min=2,max=50"`
+	Description string              `json:"description"`
+	Permissions []models.Permission `json:"permissions" binding:"required"`
+}
+
+type UpdateRoleRequest struct {
+	Description *string             `json:"description"`
+	Permissions []models.Permission `json:"permissions"`
+}
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Проверяет, что все права есть в каталоге и не содержат "*"
+func validPermissions(permissions []models.Permission) bool {
+	for _, permission := range permissions {
+		if _, ok := models.Permissions[permission]; !ok || permission == models.PermissionAll {
+			return false
+		}
+	}
+	return true
+}
+
+func setRolePermissions(tx *sqlx.Tx, role string, permissions []models.Permission) error {
+	if _, err := tx.Exec("DELETE FROM role_permissions WHERE role = $1", role); err != nil {
+		return err
+	}
+
+	for _, permission := range permissions {
+		_, err := tx.Exec("INSERT INTO role_permissions (role, permission) VALUES ($1, $2) ON CONFLICT DO NOTHING", role, permission)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Каталог доступных прав
+func (h *RoleHandler) GetPermissions(c *gin.Context) {
+	permissions := make([]gin.H, 0, len(models.Permissions))
+	for permission, description := range models.Permissions {
+		permissions = append(permissions, gin.H{"name": permission, "description": description})
+	}
+	sort.Slice(permissions, func(i, j int) bool {
+		return permissions[i]["name"].(models.Permission) < permissions[j]["name"].(models.Permission)
+	})
+
+	c.JSON(http.StatusOK, gin.H{"permissions": permissions})
+}
+
+// Получение списка ролей с правами
+func (h *RoleHandler) GetRoles(c *gin.Context) {
+	var roles []models.RoleInfo
+	err := h.DB.Select(&roles, "SELECT name, description, is_system, created_at, updated_at FROM roles ORDER BY is_system DESC, name")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения ролей"})
+		return
+	}
+
+	var grants []struct {
+		Role       models.Role       `db:"role"`
+		Permission models.Permission `db:"permission"`
+	}
+	err = h.DB.Select(&grants, "SELECT role, permission FROM role_permissions ORDER BY permission")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения ролей"})
+		return
+	}
+
+	byRole := make(map[models.Role][]models.Permission)
+	for _, grant := range grants {
+		byRole[grant.Role] = append(byRole[grant.Role], grant.Permission)
+	}
+	for i := range roles {
+		roles[i].Permissions = byRole[roles[i].Name]
+		if roles[i].Permissions == nil {
+			roles[i].Permissions = []models.Permission{}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+// Создание пользовательской роли
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	var req CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !roleNamePattern.MatchString(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Имя роли может содержать только строчные латинские буквы, цифры и _"})
+		return
+	}
+
+	if !validPermissions(req.Permissions) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неизвестное право доступа"})
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.Get(&exists, "SELECT EXISTS(SELECT 1 FROM roles WHERE name = $1)", req.Name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "Роль с таким именем уже существует"})
+		return
+	}
+
+	if _, err := tx.Exec("INSERT INTO roles (name, description) VALUES ($1, $2)", req.Name, req.Description); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания роли"})
+		return
+	}
+
+	if err := setRolePermissions(tx, req.Name, req.Permissions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания роли"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания роли"})
+		return
+	}
+	h.States.InvalidateRoles()
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Роль успешно создана"})
+}
+
+// Изменение описания и прав роли
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	name := c.Param("name")
+
+	var req UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Права суперадмина не редактируются, чтобы нельзя было потерять доступ к системе
+	if models.Role(name) == models.RoleSuperAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Нельзя изменить роль суперадмина"})
+		return
+	}
+
+	if req.Permissions != nil && !validPermissions(req.Permissions) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неизвестное право доступа"})
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.Get(&exists, "SELECT EXISTS(SELECT 1 FROM roles WHERE name = $1)", name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Роль не найдена"})
+		return
+	}
+
+	if req.Description != nil {
+		if _, err := tx.Exec("UPDATE roles SET description = $1, updated_at = NOW() WHERE name = $2", *req.Description, name); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления роли"})
+			return
+		}
+	}
+
+	if req.Permissions != nil {
+		if err := setRolePermissions(tx, name, req.Permissions); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления роли"})
+			return
+		}
+		if _, err := tx.Exec("UPDATE roles SET updated_at = NOW() WHERE name = $1", name); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления роли"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления роли"})
+		return
+	}
+	h.States.InvalidateRoles()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Роль успешно обновлена"})
+}
+
+// Удаление пользовательской роли
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	name := c.Param("name")
+
+	var role struct {
+		IsSystem bool `db:"is_system"`
+		Users    int  `db:"users"`
+	}
+	err := h.DB.Get(&role,
+		"SELECT is_system, (SELECT COUNT(*) FROM users WHERE role = roles.name) AS users FROM roles WHERE name = $1",
+		name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Роль не найдена"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if role.IsSystem {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Нельзя удалить системную роль"})
+		return
+	}
+
+	if role.Users > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Роль назначена пользователям", "users": role.Users})
+		return
+	}
+
+	if _, err := h.DB.Exec("DELETE FROM roles WHERE name = $1", name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления роли"})
+		return
+	}
+	h.States.InvalidateRoles()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Роль удалена"})
+}
+
+type ChangeUserRoleRequest struct {
+	Role   models.Role `json:"role" binding:"required"`
+	Reason string      `json:"reason" binding:"max=500"`
+}
+
+// Назначение роли пользователю
+func (h *RoleHandler) ChangeUserRole(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID пользователя"})
+		return
+	}
+
+	var req ChangeUserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	actorID := c.GetInt64("userID")
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	defer tx.Rollback()
+
+	var roleExists bool
+	if err := tx.Get(&roleExists, "SELECT EXISTS(SELECT 1 FROM roles WHERE name = $1)", req.Role); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if !roleExists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Роль не найдена"})
+		return
+	}
+
+	// Блокируем строки суперадминов, чтобы параллельные понижения не оставили систему без них
+	var superAdmins []int64
+	if err := tx.Select(&superAdmins, "SELECT id FROM users WHERE role = $1 AND deleted_at IS NULL FOR UPDATE", models.RoleSuperAdmin); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	var currentRole models.Role
+	err = tx.Get(&currentRole, "SELECT role FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if currentRole == req.Role {
+		c.JSON(http.StatusOK, gin.H{"message": "Роль не изменилась"})
+		return
+	}
+
+	if currentRole == models.RoleSuperAdmin && len(superAdmins) <= 1 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Нельзя снять роль с последнего суперадмина"})
+		return
+	}
+
+	_, err = tx.Exec("UPDATE users SET role = $1, updated_at = NOW() WHERE id = $2", req.Role, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка изменения роли"})
+		return
+	}
+
+	_, err = tx.Exec("INSERT INTO role_changes (user_id, old_role, new_role, changed_by, reason) VALUES ($1, $2, $3, $4, $5)",
+		userID, currentRole, req.Role, actorID, req.Reason)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка изменения роли"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка изменения роли"})
+		return
+	}
+	h.States.Invalidate(userID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Роль пользователя изменена",
+		"old_role": currentRole,
+		"new_role": req.Role,
+	})
+}
+
+// История изменений ролей, опционально по одному пользователю
+func (h *RoleHandler) GetRoleChanges(c *gin.Context) {
+	query := `SELECT rc.id, rc.user_id, u.username, rc.old_role, rc.new_role, rc.changed_by, rc.reason, rc.created_at
+              FROM role_changes rc JOIN users u ON u.id = rc.user_id`
+	args := []interface{}{}
+
+	if userIDStr := c.Query("user_id"); userIDStr != "" {
+		userID, err := strconv.ParseInt(userIDStr, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID пользователя"})
+			return
+		}
+		query += " WHERE rc.user_id = $1"
+		args = append(args, userID)
+	}
+
+	query += " ORDER BY rc.created_at DESC LIMIT 500"
+
+	var changes []models.RoleChange
+	if err := h.DB.Select(&changes, query, args...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения истории ролей"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"changes": changes})
+}
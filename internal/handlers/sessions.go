@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"database/sql"
+	"mango/internal/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Список активных сессий пользователя
+func (h *UserHandler) GetSessions(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	currentSessionID := c.GetInt64("sessionID")
+
+	var sessions []models.Session
+	err := h.DB.Select(&sessions,
+		`SELECT id, user_id, family_id, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at FROM sessions
+         WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+         ORDER BY last_seen_at DESC`,
+		userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения сессий"})
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionID
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// Завершение одной сессии
+func (h *UserHandler) RevokeSession(c *gin.Context) {
+	sessionID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID сессии"})
+		return
+	}
+
+	var familyID string
+	err = h.DB.Get(&familyID,
+		"SELECT family_id FROM sessions WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL",
+		sessionID, c.GetInt64("userID"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Сессия не найдена"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	defer tx.Rollback()
+
+	revoked, err := revokeTokenFamily(tx, familyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка завершения сессии"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка завершения сессии"})
+		return
+	}
+	h.States.InvalidateSessions(revoked...)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Сессия завершена"})
+}
+
+// Завершение всех сессий, кроме текущей
+func (h *UserHandler) RevokeOtherSessions(c *gin.Context) {
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	defer tx.Rollback()
+
+	revoked, err := revokeUserSessions(tx, c.GetInt64("userID"), c.GetInt64("sessionID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка завершения сессий"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка завершения сессий"})
+		return
+	}
+	h.States.InvalidateSessions(revoked...)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Остальные сессии завершены",
+		"revoked": len(revoked),
+	})
+}
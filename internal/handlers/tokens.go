@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"database/sql"
+	"mango/internal/auth"
+	"mango/internal/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// Создает refresh-токен в указанном семействе и возвращает его значение и ID
+func createRefreshToken(q sqlx.Queryer, userID int64, familyID string) (string, int64, error) {
+	token, hash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", 0, err
+	}
+
+	var id int64
+	err = sqlx.Get(q, &id,
+		"INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at) VALUES ($1, $2, $3, $4) RETURNING id",
+		userID, hash, familyID, time.Now().Add(auth.RefreshTokenTTL))
+	if err != nil {
+		return "", 0, err
+	}
+
+	return token, id, nil
+}
+
+// Открывает новую сессию и выдает пару access/refresh токенов с новым семейством
+func (h *UserHandler) issueTokens(c *gin.Context, user models.User) (gin.H, error) {
+	familyID, err := auth.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var sessionID int64
+	err = tx.Get(&sessionID,
+		"INSERT INTO sessions (user_id, family_id, user_agent, ip, expires_at) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		user.ID, familyID, c.Request.UserAgent(), c.ClientIP(), time.Now().Add(auth.RefreshTokenTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, _, err := createRefreshToken(tx, user.ID, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	accessToken, err := auth.GenerateToken(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+		"expires_in":    int(auth.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// Завершает вход: выдает пару токенов и данные пользователя
+func (h *UserHandler) completeLogin(c *gin.Context, user models.User) {
+	response, err := h.issueTokens(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка генерации токена"})
+		return
+	}
+
+	response["user"] = gin.H{
+		"id":             user.ID,
+		"username":       user.Username,
+		"email":          user.Email,
+		"role":           user.Role,
+		"email_verified": user.EmailVerified,
+		"totp_enabled":   user.TOTPEnabled,
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Завершает сессию: отзывает все активные токены семейства.
+// Возвращает ID завершенных сессий для сброса кеша.
+func revokeTokenFamily(e sqlx.Ext, familyID string) ([]int64, error) {
+	_, err := e.Exec("UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL", familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessionIDs []int64
+	err = sqlx.Select(e, &sessionIDs, "UPDATE sessions SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL RETURNING id", familyID)
+	return sessionIDs, err
+}
+
+// Завершает все сессии пользователя, кроме exceptSessionID (0 - завершить все)
+func revokeUserSessions(e sqlx.Ext, userID, exceptSessionID int64) ([]int64, error) {
+	var sessionIDs []int64
+	err := sqlx.Select(e, &sessionIDs,
+		"UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND id != $2 AND revoked_at IS NULL RETURNING id",
+		userID, exceptSessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = e.Exec(
+		`UPDATE refresh_tokens SET revoked_at = NOW()
+         WHERE user_id = $1 AND revoked_at IS NULL
+           AND family_id NOT IN (SELECT family_id FROM sessions WHERE id = $2)`,
+		userID, exceptSessionID)
+	return sessionIDs, err
+}
+
+// Обновление пары токенов (ротация refresh-токена)
+func (h *UserHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	defer tx.Rollback()
+
+	var stored models.RefreshToken
+	err = tx.Get(&stored,
+		"SELECT id, user_id, token_hash, family_id, expires_at, revoked_at, replaced_by, created_at FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE",
+		auth.HashToken(req.RefreshToken))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Недействительный refresh-токен"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	// Повторное использование отозванного токена - считаем семейство скомпрометированным
+	if stored.RevokedAt != nil {
+		revoked, err := revokeTokenFamily(tx, stored.FamilyID)
+		if err != nil || tx.Commit() != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+			return
+		}
+		h.States.InvalidateSessions(revoked...)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Обнаружено повторное использование refresh-токена, все сессии завершены"})
+		return
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Срок действия refresh-токена истек"})
+		return
+	}
+
+	var user models.User
+	err = tx.Get(&user, "SELECT id, username, email, role, "+models.IsBlockedSQL+", email_verified, totp_enabled, token_version FROM users WHERE id = $1 AND deleted_at IS NULL", stored.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Пользователь не найден"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if user.IsBlocked {
+		revoked, err := revokeTokenFamily(tx, stored.FamilyID)
+		if err != nil || tx.Commit() != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+			return
+		}
+		h.States.InvalidateSessions(revoked...)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Аккаунт заблокирован"})
+		return
+	}
+
+	// Продлеваем сессию
+	var sessionID int64
+	err = tx.Get(&sessionID,
+		"UPDATE sessions SET last_seen_at = NOW(), ip = $1, expires_at = $2 WHERE family_id = $3 AND revoked_at IS NULL RETURNING id",
+		c.ClientIP(), time.Now().Add(auth.RefreshTokenTTL), stored.FamilyID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Сессия завершена"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	refreshToken, newID, err := createRefreshToken(tx, user.ID, stored.FamilyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания refresh-токена"})
+		return
+	}
+
+	_, err = tx.Exec("UPDATE refresh_tokens SET revoked_at = NOW(), replaced_by = $1 WHERE id = $2", newID, stored.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	accessToken, err := auth.GenerateToken(user, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка генерации токена"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+		"expires_in":    int(auth.AccessTokenTTL.Seconds()),
+	})
+}
+
+// Выход из системы - отзыв семейства refresh-токенов
+func (h *UserHandler) Logout(c *gin.Context) {
+	var req LogoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var familyID string
+	err := h.DB.Get(&familyID, "SELECT family_id FROM refresh_tokens WHERE token_hash = $1", auth.HashToken(req.RefreshToken))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// Неизвестный токен - считаем, что выход уже выполнен
+			c.JSON(http.StatusOK, gin.H{"message": "Выход выполнен"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	defer tx.Rollback()
+
+	revoked, err := revokeTokenFamily(tx, familyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка выхода из системы"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка выхода из системы"})
+		return
+	}
+	h.States.InvalidateSessions(revoked...)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Выход выполнен"})
+}
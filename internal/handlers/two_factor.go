@@ -0,0 +1,432 @@
+package handlers
+
+import (
+	"database/sql"
+	"mango/internal/auth"
+	"mango/internal/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// Параметры второго шага входа
+const (
+	mfaChallengeTTL         = 5 * time.Minute
+	mfaChallengeMaxAttempts = 5
+	recoveryCodesCount      = 10
+	totpIssuer              = "Mango"
+)
+
+type TwoFactorLoginRequest struct {
+	Challenge    string `json:"challenge" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password     string `json:"password" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// Создает одноразовый вызов для второго шага входа
+func (h *UserHandler) createMFAChallenge(userID int64) (string, error) {
+	token, hash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = h.DB.Exec("INSERT INTO mfa_challenges (user_id, token_hash, expires_at) VALUES ($1, $2, $3)",
+		userID, hash, time.Now().Add(mfaChallengeTTL))
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Проверяет TOTP-код (с защитой от повторного использования) или код восстановления
+func verifySecondFactor(tx *sqlx.Tx, userID int64, secret, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		step, ok := auth.ValidateTOTP(secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+
+		result, err := tx.Exec(
+			"UPDATE users SET totp_last_step = $1 WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)",
+			step, userID)
+		if err != nil {
+			return false, err
+		}
+		rows, _ := result.RowsAffected()
+		return rows == 1, nil
+	}
+
+	if recoveryCode != "" {
+		result, err := tx.Exec(
+			"UPDATE recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL",
+			userID, auth.HashToken(auth.NormalizeRecoveryCode(recoveryCode)))
+		if err != nil {
+			return false, err
+		}
+		rows, _ := result.RowsAffected()
+		return rows == 1, nil
+	}
+
+	return false, nil
+}
+
+// Заменяет коды восстановления пользователя новыми
+func replaceRecoveryCodes(tx *sqlx.Tx, userID int64) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodesCount)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return nil, err
+	}
+
+	for _, code := range codes {
+		_, err := tx.Exec("INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, auth.HashToken(code))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, nil
+}
+
+// Второй шаг входа - проверка кода двухфакторной аутентификации
+func (h *UserHandler) LoginTwoFactor(c *gin.Context) {
+	var req TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Code == "" && req.RecoveryCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите код подтверждения или код восстановления"})
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	defer tx.Rollback()
+
+	var challenge struct {
+		ID       int64 `db:"id"`
+		UserID   int64 `db:"user_id"`
+		Attempts int   `db:"attempts"`
+	}
+	err = tx.Get(&challenge,
+		"SELECT id, user_id, attempts FROM mfa_challenges WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW() FOR UPDATE",
+		auth.HashToken(req.Challenge))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Сессия входа истекла, войдите заново"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	var user models.User
+	err = tx.Get(&user,
+		"SELECT id, username, email, display_name, bio, avatar_url, role, "+models.IsBlockedSQL+", email_verified, totp_enabled, token_version FROM users WHERE id = $1 AND deleted_at IS NULL",
+		challenge.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if user.IsBlocked {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Аккаунт заблокирован"})
+		return
+	}
+
+	var secret string
+	if err := tx.Get(&secret, "SELECT COALESCE(totp_secret, '') FROM users WHERE id = $1", user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	ok, err := verifySecondFactor(tx, user.ID, secret, req.Code, req.RecoveryCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if !ok {
+		// После исчерпания попыток вызов становится недействительным
+		_, err = tx.Exec(
+			"UPDATE mfa_challenges SET attempts = attempts + 1, used_at = CASE WHEN attempts + 1 >= $1 THEN NOW() END WHERE id = $2",
+			mfaChallengeMaxAttempts, challenge.ID)
+		if err != nil || tx.Commit() != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+			return
+		}
+		if err := h.Throttle.RecordFailure(user.Username, c.ClientIP()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверный код подтверждения"})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE mfa_challenges SET used_at = NOW() WHERE id = $1", challenge.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	h.completeLogin(c, user)
+}
+
+// Начало подключения двухфакторной аутентификации - выдача секрета
+func (h *UserHandler) SetupTwoFactor(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	var user models.User
+	err := h.DB.Get(&user, "SELECT id, username, totp_enabled FROM users WHERE id = $1", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Двухфакторная аутентификация уже включена"})
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка генерации секрета"})
+		return
+	}
+
+	_, err = h.DB.Exec("UPDATE users SET totp_secret = $1, updated_at = NOW() WHERE id = $2", secret, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": auth.TOTPURI(totpIssuer, user.Username, secret),
+	})
+}
+
+// Подтверждение подключения двухфакторной аутентификации кодом из приложения
+func (h *UserHandler) EnableTwoFactor(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetInt64("userID")
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	defer tx.Rollback()
+
+	var state struct {
+		Secret  sql.NullString `db:"totp_secret"`
+		Enabled bool           `db:"totp_enabled"`
+	}
+	err = tx.Get(&state, "SELECT totp_secret, totp_enabled FROM users WHERE id = $1 FOR UPDATE", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if state.Enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Двухфакторная аутентификация уже включена"})
+		return
+	}
+
+	if !state.Secret.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Сначала получите секрет для подключения"})
+		return
+	}
+
+	ok, err := verifySecondFactor(tx, userID, state.Secret.String, req.Code, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный код подтверждения"})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE users SET totp_enabled = true, updated_at = NOW() WHERE id = $1", userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка генерации кодов восстановления"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	h.States.Invalidate(userID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Двухфакторная аутентификация включена",
+		"recovery_codes": codes,
+	})
+}
+
+// Отключение двухфакторной аутентификации
+func (h *UserHandler) DisableTwoFactor(c *gin.Context) {
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetInt64("userID")
+	userRole := c.MustGet("userRole").(models.Role)
+
+	if h.TwoFactorPolicy.Requires(userRole) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Двухфакторная аутентификация обязательна для вашей роли"})
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	defer tx.Rollback()
+
+	var state struct {
+		Password string         `db:"password"`
+		Secret   sql.NullString `db:"totp_secret"`
+		Enabled  bool           `db:"totp_enabled"`
+	}
+	err = tx.Get(&state, "SELECT password, totp_secret, totp_enabled FROM users WHERE id = $1 FOR UPDATE", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if !state.Enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Двухфакторная аутентификация не включена"})
+		return
+	}
+
+	if !auth.CheckPassword(req.Password, state.Password) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный пароль"})
+		return
+	}
+
+	ok, err := verifySecondFactor(tx, userID, state.Secret.String, req.Code, req.RecoveryCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный код подтверждения"})
+		return
+	}
+
+	_, err = tx.Exec("UPDATE users SET totp_enabled = false, totp_secret = NULL, totp_last_step = NULL, updated_at = NOW() WHERE id = $1", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	h.States.Invalidate(userID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Двухфакторная аутентификация отключена"})
+}
+
+// Выпуск новых кодов восстановления
+func (h *UserHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetInt64("userID")
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	defer tx.Rollback()
+
+	var state struct {
+		Secret  sql.NullString `db:"totp_secret"`
+		Enabled bool           `db:"totp_enabled"`
+	}
+	err = tx.Get(&state, "SELECT totp_secret, totp_enabled FROM users WHERE id = $1 FOR UPDATE", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if !state.Enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Двухфакторная аутентификация не включена"})
+		return
+	}
+
+	ok, err := verifySecondFactor(tx, userID, state.Secret.String, req.Code, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный код подтверждения"})
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка генерации кодов восстановления"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
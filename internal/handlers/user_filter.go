@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"mango/internal/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserFilter - условия отбора пользователей в админке
+type UserFilter struct {
+	Search      string `form:"search" json:"search"`
+	Role        string `form:"role" json:"role"`
+	Blocked     *bool  `form:"blocked" json:"blocked"`
+	Deleted     bool   `form:"deleted" json:"deleted"`
+	CreatedFrom string `form:"created_from" json:"created_from"`
+	CreatedTo   string `form:"created_to" json:"created_to"`
+}
+
+// Допустимые поля сортировки списка пользователей
+var userSortColumns = map[string]string{
+	"id":         "id",
+	"username":   "username",
+	"email":      "email",
+	"role":       "role",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+const userColumns = "id, username, email, role, " + models.IsBlockedSQL + ", blocked_reason, blocked_until, email_verified, deleted_at, created_at, updated_at"
+
+// where строит условие WHERE; плейсхолдеры нумеруются с argIndex
+func (f UserFilter) where(argIndex int) (string, []interface{}, error) {
+	// Без deleted=true удаленные скрыты; обезличенные не показываются никогда
+	condition := "deleted_at IS NULL"
+	if f.Deleted {
+		condition = "deleted_at IS NOT NULL AND anonymized_at IS NULL"
+	}
+	args := []interface{}{}
+
+	if f.Search != "" {
+		condition += " AND (username ILIKE $" + strconv.Itoa(argIndex) + " OR email ILIKE $" + strconv.Itoa(argIndex) + ")"
+		args = append(args, "%"+escapeLike(f.Search)+"%")
+		argIndex++
+	}
+
+	if f.Role != "" {
+		condition += " AND role = $" + strconv.Itoa(argIndex)
+		args = append(args, f.Role)
+		argIndex++
+	}
+
+	if f.Blocked != nil {
+		condition += " AND " + models.BlockedSQL + " = $" + strconv.Itoa(argIndex)
+		args = append(args, *f.Blocked)
+		argIndex++
+	}
+
+	if f.CreatedFrom != "" {
+		from, _, err := parseFilterDate(f.CreatedFrom)
+		if err != nil {
+			return "", nil, fmt.Errorf("Неверный формат created_from: ожидается ГГГГ-ММ-ДД или RFC 3339")
+		}
+		condition += " AND created_at >= $" + strconv.Itoa(argIndex)
+		args = append(args, from)
+		argIndex++
+	}
+
+	if f.CreatedTo != "" {
+		to, dateOnly, err := parseFilterDate(f.CreatedTo)
+		if err != nil {
+			return "", nil, fmt.Errorf("Неверный формат created_to: ожидается ГГГГ-ММ-ДД или RFC 3339")
+		}
+		// Дата без времени включает весь день
+		if dateOnly {
+			condition += " AND created_at < $" + strconv.Itoa(argIndex)
+			args = append(args, to.AddDate(0, 0, 1))
+		} else {
+			condition += " AND created_at <= $" + strconv.Itoa(argIndex)
+			args = append(args, to)
+		}
+	}
+
+	return condition, args, nil
+}
+
+// Даты фильтра приводятся к UTC: created_at хранится без часового пояса
+func parseFilterDate(value string) (time.Time, bool, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t.UTC(), false, err
+}
+
+// Сортировка из параметров sort и order; по умолчанию - сначала новые
+func userOrderBy(c *gin.Context) (string, error) {
+	column, ok := userSortColumns[c.DefaultQuery("sort", "created_at")]
+	if !ok {
+		return "", fmt.Errorf("Недопустимое поле сортировки")
+	}
+
+	switch c.DefaultQuery("order", "desc") {
+	case "asc":
+		return " ORDER BY " + column + " ASC, id ASC", nil
+	case "desc":
+		return " ORDER BY " + column + " DESC, id DESC", nil
+	default:
+		return "", fmt.Errorf("Порядок сортировки должен быть asc или desc")
+	}
+}
+
+// Выгрузка отфильтрованного списка пользователей в CSV (только для админов)
+func (h *UserHandler) ExportUsers(c *gin.Context) {
+	var filter UserFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	where, args, err := filter.where(1)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	orderBy, err := userOrderBy(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var users []models.User
+	err = h.DB.Select(&users, "SELECT "+userColumns+" FROM users WHERE "+where+orderBy, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения пользователей"})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="users-`+time.Now().Format("20060102")+`.csv"`)
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	// BOM, чтобы Excel распознал UTF-8
+	c.Writer.WriteString("\ufeff")
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"id", "username", "email", "role", "is_blocked", "blocked_until", "email_verified", "created_at", "updated_at"})
+	for _, user := range users {
+		blockedUntil := ""
+		if user.BlockedUntil != nil {
+			blockedUntil = user.BlockedUntil.Format(time.RFC3339)
+		}
+		w.Write([]string{
+			strconv.FormatInt(user.ID, 10),
+			csvSafe(user.Username),
+			csvSafe(user.Email),
+			string(user.Role),
+			strconv.FormatBool(user.IsBlocked),
+			blockedUntil,
+			strconv.FormatBool(user.EmailVerified),
+			user.CreatedAt,
+			user.UpdatedAt,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		c.Error(err)
+	}
+}
+
+// Экранирует значения, которые табличные редакторы приняли бы за формулу
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
@@ -2,23 +2,37 @@ package handlers
 
 import (
 	"database/sql"
+	"log"
 	"mango/internal/auth"
+	"mango/internal/avatar"
 	"mango/internal/models"
+	"mango/internal/oidc"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
 )
 
 type UserHandler struct {
-	DB *sqlx.DB
+	DB              *sqlx.DB
+	States          *auth.UserStates
+	AppURL          string
+	EmailPolicy     auth.EmailPolicy
+	TwoFactorPolicy auth.TwoFactorPolicy
+	Throttle        *auth.LoginThrottle
+	OIDC            map[string]*oidc.Provider
+	PasswordPolicy  *auth.PasswordPolicy
+	DeletionGrace   time.Duration
+	InviteOnly      bool
+	Avatars         *avatar.Store
 }
 
 type RegisterRequest struct {
 	Username string `json:"username" binding:"required,min=3,max=50"`
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Password string `json:"password" binding:"required"`
 }
 
 type LoginRequest struct {
@@ -27,17 +41,29 @@ type LoginRequest struct {
 }
 
 type ChangeProfileRequest struct {
-	Username string `json:"username" binding:"required,min=3,max=50"`
-	Email    string `json:"email" binding:"required,email"`
+	Username    string  `json:"username" binding:"required,min=3,max=50"`
+	Email       string  `json:"email" binding:"required,email"`
+	DisplayName *string `json:"display_name" binding:"omitempty,max=100"`
+	Bio         *string `json:"bio" binding:"omitempty,max=1000"`
+}
+
+type BlockUserRequest struct {
+	Reason string     `json:"reason" binding:"max=500"`
+	Until  *time.Time `json:"until"`
 }
 
 type ChangePasswordRequest struct {
 	OldPassword string `json:"old_password" binding:"required"`
-	NewPassword string `json:"new_password" binding:"required,min=6"`
+	NewPassword string `json:"new_password" binding:"required"`
 }
 
 // Регистрация пользователя
 func (h *UserHandler) Register(c *gin.Context) {
+	if h.InviteOnly {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Регистрация доступна только по приглашению", "code": "invite_only"})
+		return
+	}
+
 	var req RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -57,6 +83,10 @@ func (h *UserHandler) Register(c *gin.Context) {
 		return
 	}
 
+	if !h.acceptPassword(c, req.Password, req.Username, req.Email) {
+		return
+	}
+
 	// Хешируем пароль
 	hashedPassword, err := auth.HashPassword(req.Password)
 	if err != nil {
@@ -64,9 +94,16 @@ func (h *UserHandler) Register(c *gin.Context) {
 		return
 	}
 
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	defer tx.Rollback()
+
 	// Создаем пользователя
 	var userID int64
-	err = h.DB.Get(&userID,
+	err = tx.Get(&userID,
 		"INSERT INTO users (username, email, password, role) VALUES ($1, $2, $3, $4) RETURNING id",
 		req.Username, req.Email, hashedPassword, models.RoleUser)
 
@@ -75,8 +112,19 @@ func (h *UserHandler) Register(c *gin.Context) {
 		return
 	}
 
+	// Отправляем письмо для подтверждения email
+	if err := h.sendVerificationEmail(tx, userID, req.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка отправки письма"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания пользователя"})
+		return
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "Пользователь успешно зарегистрирован",
+		"message": "Пользователь успешно зарегистрирован. Подтвердите email по ссылке из письма",
 		"user_id": userID,
 	})
 }
@@ -89,45 +137,154 @@ func (h *UserHandler) Login(c *gin.Context) {
 		return
 	}
 
+	// Проверяем ограничение на частоту попыток входа
+	ip := c.ClientIP()
+	wait, err := h.Throttle.Check(req.Username, ip)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	if wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Слишком много неудачных попыток входа, попробуйте позже"})
+		return
+	}
+
 	var user models.User
-	err := h.DB.Get(&user, "SELECT id, username, email, password, role, is_blocked FROM users WHERE username = $1", req.Username)
+	err = h.DB.Get(&user, "SELECT id, username, email, password, display_name, bio, avatar_url, role, "+models.IsBlockedSQL+", blocked_reason, blocked_until, email_verified, totp_enabled, token_version FROM users WHERE username = $1 AND deleted_at IS NULL", req.Username)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверные учетные данные"})
+			h.loginFailed(c, req.Username, ip)
 			return
 		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
 		return
 	}
 
-	// Проверяем, заблокирован ли пользователь
+	// Проверяем пароль
+	if !auth.CheckPassword(req.Password, user.Password) {
+		h.loginFailed(c, req.Username, ip)
+		return
+	}
+
+	if err := h.Throttle.RecordSuccess(req.Username); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	// Причину и срок блокировки показываем только после верного пароля
 	if user.IsBlocked {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Аккаунт заблокирован"})
+		c.JSON(http.StatusForbidden, blockedResponse(user))
 		return
 	}
 
-	// Проверяем пароль
-	if !auth.CheckPassword(req.Password, user.Password) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверные учетные данные"})
+	// Пересчитываем хеш, если он создан с устаревшими параметрами
+	if auth.NeedsRehash(user.Password) {
+		h.rehashPassword(user.ID, user.Password, req.Password)
+	}
+
+	h.finishLogin(c, user)
+}
+
+// Завершает вход после проверки учетных данных: политика email и второй фактор
+func (h *UserHandler) finishLogin(c *gin.Context, user models.User) {
+	// Проверяем подтверждение email, если этого требует политика
+	if h.EmailPolicy.Requires(auth.ActionLogin) && !user.EmailVerified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Подтвердите email, чтобы войти", "code": "email_not_verified"})
 		return
 	}
 
-	// Генерируем токен
-	token, err := auth.GenerateToken(user)
+	// Для включенной двухфакторной аутентификации требуется второй шаг
+	if user.TOTPEnabled {
+		challenge, err := h.createMFAChallenge(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"challenge":           challenge,
+			"expires_in":          int(mfaChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	h.completeLogin(c, user)
+}
+
+// Сообщение о блокировке с причиной и сроком, если они указаны
+func blockedResponse(user models.User) gin.H {
+	blockedUntil := utcTime(user.BlockedUntil)
+	message := "Аккаунт заблокирован"
+	if blockedUntil != nil {
+		message += " до " + blockedUntil.Format("02.01.2006 15:04 MST")
+	}
+	if user.BlockedReason != nil {
+		message += ". Причина: " + *user.BlockedReason
+	}
+
+	return gin.H{
+		"error":         message,
+		"code":          "account_blocked",
+		"reason":        user.BlockedReason,
+		"blocked_until": blockedUntil,
+	}
+}
+
+// Срок блокировки хранится в UTC (колонка без часового пояса), иначе время
+// из запроса с другим смещением сохранилось бы как локальное для его клиента
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+// Проверяет новый пароль по политике; при отказе отвечает 400 со списком причин
+func (h *UserHandler) acceptPassword(c *gin.Context, password, username, email string) bool {
+	violations, err := h.PasswordPolicy.Validate(password, username, email)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка генерации токена"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка проверки пароля"})
+		return false
+	}
+
+	if len(violations) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   violations[0].Message,
+			"code":    "weak_password",
+			"reasons": violations,
+		})
+		return false
+	}
+
+	return true
+}
+
+// Сохраняет хеш пароля с текущими параметрами. Ошибка не мешает входу:
+// пересчет повторится при следующем входе.
+func (h *UserHandler) rehashPassword(userID int64, oldHash, password string) {
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		log.Printf("Ошибка пересчета хеша пароля пользователя %d: %v", userID, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"email":    user.Email,
-			"role":     user.Role,
-		},
-	})
+	// Условие на прежний хеш не дает затереть пароль, измененный параллельно
+	_, err = h.DB.Exec("UPDATE users SET password = $1 WHERE id = $2 AND password = $3", hashedPassword, userID, oldHash)
+	if err != nil {
+		log.Printf("Ошибка пересчета хеша пароля пользователя %d: %v", userID, err)
+	}
+}
+
+// Учитывает неудачную попытку входа и отвечает клиенту
+func (h *UserHandler) loginFailed(c *gin.Context, username, ip string) {
+	if err := h.Throttle.RecordFailure(username, ip); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверные учетные данные"})
 }
 
 // Изменение профиля
@@ -156,17 +313,59 @@ func (h *UserHandler) ChangeProfile(c *gin.Context) {
 		return
 	}
 
-	// Обновляем профиль
-	_, err = h.DB.Exec(
-		"UPDATE users SET username = $1, email = $2, updated_at = NOW() WHERE id = $3",
-		req.Username, req.Email, userID)
+	var currentEmail string
+	err = h.DB.Get(&currentEmail, "SELECT email FROM users WHERE id = $1", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
 
+	tx, err := h.DB.Beginx()
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Обновляем профиль; отсутствующие display_name и bio не меняются, пустая строка их очищает
+	_, err = tx.Exec(
+		`UPDATE users SET username = $1, email = $2,
+             display_name = CASE WHEN $3::text IS NULL THEN display_name ELSE NULLIF(TRIM($3), '') END,
+             bio = CASE WHEN $4::text IS NULL THEN bio ELSE NULLIF(TRIM($4), '') END,
+             updated_at = NOW()
+         WHERE id = $5`,
+		req.Username, req.Email, req.DisplayName, req.Bio, userID)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления профиля"})
+		return
+	}
+
+	// Новый email требует повторного подтверждения
+	emailChanged := req.Email != currentEmail
+	if emailChanged {
+		_, err = tx.Exec("UPDATE users SET email_verified = false, email_verified_at = NULL WHERE id = $1", userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления профиля"})
+			return
+		}
+
+		if err := h.sendVerificationEmail(tx, userID, req.Email); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка отправки письма"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления профиля"})
 		return
 	}
+	h.States.Invalidate(userID)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Профиль успешно обновлен"})
+	c.JSON(http.StatusOK, gin.H{
+		"message":           "Профиль успешно обновлен",
+		"verification_sent": emailChanged,
+	})
 }
 
 // Изменение пароля
@@ -180,19 +379,27 @@ func (h *UserHandler) ChangePassword(c *gin.Context) {
 	userID := c.GetInt64("userID")
 
 	// Получаем текущий пароль пользователя
-	var currentPassword string
-	err := h.DB.Get(&currentPassword, "SELECT password FROM users WHERE id = $1", userID)
+	var current struct {
+		Username string `db:"username"`
+		Email    string `db:"email"`
+		Password string `db:"password"`
+	}
+	err := h.DB.Get(&current, "SELECT username, email, password FROM users WHERE id = $1", userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
 		return
 	}
 
 	// Проверяем старый пароль
-	if !auth.CheckPassword(req.OldPassword, currentPassword) {
+	if !auth.CheckPassword(req.OldPassword, current.Password) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный текущий пароль"})
 		return
 	}
 
+	if !h.acceptPassword(c, req.NewPassword, current.Username, current.Email) {
+		return
+	}
+
 	// Хешируем новый пароль
 	hashedPassword, err := auth.HashPassword(req.NewPassword)
 	if err != nil {
@@ -200,26 +407,110 @@ func (h *UserHandler) ChangePassword(c *gin.Context) {
 		return
 	}
 
-	// Обновляем пароль
-	_, err = h.DB.Exec("UPDATE users SET password = $1, updated_at = NOW() WHERE id = $2", hashedPassword, userID)
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Обновляем пароль и версию токенов - ранее выданные токены перестают действовать
+	var user models.User
+	err = tx.Get(&user,
+		"UPDATE users SET password = $1, token_version = token_version + 1, updated_at = NOW() WHERE id = $2 RETURNING id, username, email, role, is_blocked, token_version",
+		hashedPassword, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления пароля"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Пароль успешно изменен"})
+	// Завершаем все сессии, включая текущую
+	revoked, err := revokeUserSessions(tx, userID, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления пароля"})
+		return
+	}
+	h.States.Invalidate(userID)
+	h.States.InvalidateSessions(revoked...)
+
+	// Открываем новую сессию для текущего клиента
+	response, err := h.issueTokens(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка генерации токена"})
+		return
+	}
+
+	response["message"] = "Пароль успешно изменен"
+	c.JSON(http.StatusOK, response)
 }
 
-// Получение списка пользователей (только для админов)
+// Получение списка пользователей с поиском, фильтрами, сортировкой и пагинацией (только для админов).
+// С параметром deleted=true возвращает удаленных пользователей, которых можно восстановить.
 func (h *UserHandler) GetUsers(c *gin.Context) {
-	var users []models.User
-	err := h.DB.Select(&users, "SELECT id, username, email, role, is_blocked, created_at, updated_at FROM users ORDER BY created_at DESC")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	offset := (page - 1) * limit
+
+	var filter UserFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	where, args, err := filter.where(1)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	orderBy, err := userOrderBy(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Получаем общее количество
+	var total int
+	err = h.DB.Get(&total, "SELECT COUNT(*) FROM users WHERE "+where, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка подсчета пользователей"})
+		return
+	}
+
+	argIndex := len(args) + 1
+	query := "SELECT " + userColumns + " FROM users WHERE " + where + orderBy +
+		" LIMIT $" + strconv.Itoa(argIndex) + " OFFSET $" + strconv.Itoa(argIndex+1)
+	args = append(args, limit, offset)
+
+	users := []models.User{}
+	err = h.DB.Select(&users, query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения пользователей"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"users": users})
+	c.JSON(http.StatusOK, gin.H{
+		"users": users,
+		"pagination": gin.H{
+			"page":       page,
+			"limit":      limit,
+			"total":      total,
+			"totalPages": (total + limit - 1) / limit,
+		},
+	})
 }
 
 // Блокировка пользователя (только для админов)
@@ -233,7 +524,7 @@ func (h *UserHandler) BlockUser(c *gin.Context) {
 
 	// Проверяем, существует ли пользователь
 	var user models.User
-	err = h.DB.Get(&user, "SELECT id, role FROM users WHERE id = $1", userID)
+	err = h.DB.Get(&user, "SELECT id, role FROM users WHERE id = $1 AND deleted_at IS NULL", userID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
@@ -249,16 +540,64 @@ func (h *UserHandler) BlockUser(c *gin.Context) {
 		return
 	}
 
+	// Причина и срок блокировки необязательны
+	var req BlockUserRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if req.Until != nil && !req.Until.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Срок блокировки должен быть в будущем"})
+		return
+	}
+
+	var reason *string
+	if req.Reason != "" {
+		reason = &req.Reason
+	}
+
 	// Блокируем пользователя
-	_, err = h.DB.Exec("UPDATE users SET is_blocked = true, updated_at = NOW() WHERE id = $1", userID)
+	_, err = h.DB.Exec(
+		"UPDATE users SET is_blocked = true, blocked_reason = $1, blocked_until = $2, blocked_at = NOW(), blocked_by = $3, updated_at = NOW() WHERE id = $4",
+		reason, utcTime(req.Until), c.GetInt64("userID"), userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка блокировки пользователя"})
 		return
 	}
+	h.States.Invalidate(userID)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Пользователь заблокирован"})
 }
 
+// Разблокировка пользователя (только для админов)
+func (h *UserHandler) UnblockUser(c *gin.Context) {
+	userIDStr := c.Param("id")
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID пользователя"})
+		return
+	}
+
+	result, err := h.DB.Exec(
+		"UPDATE users SET is_blocked = false, blocked_reason = NULL, blocked_until = NULL, blocked_at = NULL, blocked_by = NULL, updated_at = NOW() WHERE id = $1 AND deleted_at IS NULL",
+		userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка разблокировки пользователя"})
+		return
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+		return
+	}
+	h.States.Invalidate(userID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Пользователь разблокирован"})
+}
+
 // Удаление пользователя (только для админов)
 func (h *UserHandler) DeleteUser(c *gin.Context) {
 	userIDStr := c.Param("id")
@@ -270,7 +609,7 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 
 	// Проверяем, существует ли пользователь
 	var user models.User
-	err = h.DB.Get(&user, "SELECT id, role FROM users WHERE id = $1", userID)
+	err = h.DB.Get(&user, "SELECT id, role FROM users WHERE id = $1 AND deleted_at IS NULL", userID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
@@ -286,12 +625,61 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
-	// Удаляем пользователя
-	_, err = h.DB.Exec("DELETE FROM users WHERE id = $1", userID)
+	// Помечаем пользователя удаленным: строка остается для ссылок из других таблиц
+	// и восстановления, персональные данные стираются после срока хранения
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE users SET deleted_at = NOW(), deleted_by = $1, updated_at = NOW() WHERE id = $2 AND deleted_at IS NULL",
+		c.GetInt64("userID"), userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления пользователя"})
 		return
 	}
 
+	revoked, err := revokeUserSessions(tx, userID, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления пользователя"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления пользователя"})
+		return
+	}
+	h.States.Invalidate(userID)
+	h.States.InvalidateSessions(revoked...)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Пользователь удален"})
 }
+
+// Восстановление удаленного пользователя (только для админов)
+func (h *UserHandler) RestoreUser(c *gin.Context) {
+	userIDStr := c.Param("id")
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID пользователя"})
+		return
+	}
+
+	// Обезличенного пользователя восстановить нельзя - его данных больше нет
+	result, err := h.DB.Exec(
+		"UPDATE users SET deleted_at = NULL, deleted_by = NULL, updated_at = NOW() WHERE id = $1 AND deleted_at IS NOT NULL AND anonymized_at IS NULL",
+		userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка восстановления пользователя"})
+		return
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Удаленный пользователь не найден"})
+		return
+	}
+	h.States.Invalidate(userID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Пользователь восстановлен"})
+}
@@ -0,0 +1,36 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// FileMailer сохраняет письма в каталог в формате .eml для локальной
+// разработки и тестов. Если Dir не задан, в лог выводятся только получатель
+// и тема: тело содержит одноразовые ссылки, которым не место в логах.
+type FileMailer struct {
+	Dir  string
+	From string
+
+	counter atomic.Int64
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	if m.Dir == "" {
+		log.Printf("Письмо для %s: %s (текст скрыт)", msg.To, msg.Subject)
+		return nil
+	}
+
+	data := buildMessage(m.From, msg)
+
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%d.eml", time.Now().UnixNano(), m.counter.Add(1))
+	return os.WriteFile(filepath.Join(m.Dir, name), data, 0o644)
+}
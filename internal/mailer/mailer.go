@@ -0,0 +1,13 @@
+package mailer
+
+// Message - письмо в виде простого текста
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer доставляет письма получателю
+type Mailer interface {
+	Send(msg Message) error
+}
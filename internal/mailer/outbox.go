@@ -0,0 +1,97 @@
+package mailer
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Enqueue ставит письмо в очередь отправки. Принимает транзакцию, чтобы
+// письмо уходило только при успешной фиксации изменений.
+func Enqueue(e sqlx.Execer, msg Message) error {
+	_, err := e.Exec("INSERT INTO email_outbox (recipient, subject, body) VALUES ($1, $2, $3)", msg.To, msg.Subject, msg.Body)
+	return err
+}
+
+// Outbox периодически отправляет письма из таблицы email_outbox
+type Outbox struct {
+	DB          *sqlx.DB
+	Mailer      Mailer
+	Interval    time.Duration
+	BatchSize   int
+	MaxAttempts int
+}
+
+type outboxRow struct {
+	ID        int64  `db:"id"`
+	Recipient string `db:"recipient"`
+	Subject   string `db:"subject"`
+	Body      string `db:"body"`
+	Attempts  int    `db:"attempts"`
+}
+
+// Run обрабатывает очередь до отмены контекста
+func (o *Outbox) Run(ctx context.Context) {
+	ticker := time.NewTicker(o.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := o.processBatch(); err != nil {
+			log.Printf("Ошибка обработки очереди писем: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Время, на которое письмо резервируется за отправителем. Если процесс упадет
+// во время отправки, письмо снова попадет в очередь после истечения резерва.
+const outboxLease = 10 * time.Minute
+
+func (o *Outbox) processBatch() error {
+	// Резервируем пачку отдельным запросом: отправка идет вне транзакции,
+	// чтобы сбой записи одного статуса не откатывал уже отправленные письма
+	var rows []outboxRow
+	err := o.DB.Select(&rows,
+		`UPDATE email_outbox SET send_after = $1
+         WHERE id IN (
+             SELECT id FROM email_outbox
+             WHERE status = 'pending' AND send_after <= NOW()
+             ORDER BY id LIMIT $2 FOR UPDATE SKIP LOCKED
+         )
+         RETURNING id, recipient, subject, body, attempts`,
+		time.Now().Add(outboxLease), o.BatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		sendErr := o.Mailer.Send(Message{To: row.Recipient, Subject: row.Subject, Body: row.Body})
+		if sendErr == nil {
+			// Тело с одноразовыми ссылками после отправки не храним
+			_, err = o.DB.Exec("UPDATE email_outbox SET status = 'sent', attempts = attempts + 1, sent_at = NOW(), body = '' WHERE id = $1", row.ID)
+		} else {
+			attempts := row.Attempts + 1
+			status := "pending"
+			if attempts >= o.MaxAttempts {
+				status = "failed"
+			}
+			// Экспоненциальная задержка между попытками
+			delay := time.Duration(1<<attempts) * time.Minute
+			_, err = o.DB.Exec(
+				"UPDATE email_outbox SET status = $1, attempts = $2, last_error = $3, send_after = $4, body = CASE WHEN $1 = 'failed' THEN '' ELSE body END WHERE id = $5",
+				status, attempts, sendErr.Error(), time.Now().Add(delay), row.ID)
+		}
+		if err != nil {
+			log.Printf("Ошибка обновления статуса письма %d: %v", row.ID, err)
+		}
+	}
+
+	return nil
+}
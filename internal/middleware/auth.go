@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"log"
 	"mango/internal/auth"
 	"mango/internal/models"
 	"net/http"
@@ -10,42 +11,140 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func AuthRequired(allowedRoles ...models.Role) gin.HandlerFunc {
+// AuthRequired пропускает запросы с действующим JWT; API-ключи отклоняются
+func AuthRequired(states *auth.UserStates, allowedRoles ...models.Role) gin.HandlerFunc {
+	return authenticate(states, false, allowedRoles)
+}
+
+// AuthRequiredOrAPIKey дополнительно принимает API-ключи. Scopes ключа проверяет
+// PermissionRequired, поэтому подключать только к группам, где каждый маршрут через него проходит.
+func AuthRequiredOrAPIKey(states *auth.UserStates, allowedRoles ...models.Role) gin.HandlerFunc {
+	return authenticate(states, true, allowedRoles)
+}
+
+func authenticate(states *auth.UserStates, allowAPIKeys bool, allowedRoles []models.Role) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := c.GetHeader("Authorization")
+
+		// Убираем "Bearer " из токена
+		if strings.HasPrefix(tokenString, "Bearer ") {
+			tokenString = tokenString[7:]
+		}
+
+		// API-ключ может передаваться и в отдельном заголовке
+		if key := c.GetHeader("X-API-Key"); key != "" {
+			tokenString = key
+		}
+
 		if tokenString == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется авторизация"})
 			c.Abort()
 			return
 		}
 
-		// Убираем "Bearer " из токена
-		if strings.HasPrefix(tokenString, "Bearer ") {
-			tokenString = tokenString[7:]
+		var (
+			userID    int64
+			version   int
+			sessionID int64
+			claims    jwt.MapClaims
+			apiKey    *models.APIKey
+		)
+
+		if auth.IsAPIKey(tokenString) {
+			if !allowAPIKeys {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Действие недоступно при доступе по API-ключу"})
+				c.Abort()
+				return
+			}
+
+			key, err := states.LookupAPIKey(tokenString)
+			if err != nil {
+				if err == auth.ErrInvalidAPIKey {
+					c.JSON(http.StatusUnauthorized, gin.H{"error": "Недействительный API-ключ"})
+					c.Abort()
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+				c.Abort()
+				return
+			}
+			apiKey = key
+			userID = key.UserID
+		} else {
+			token, err := jwt.Parse(tokenString, auth.Keys.Keyfunc)
+
+			if err != nil || !token.Valid {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Недействительный токен"})
+				c.Abort()
+				return
+			}
+
+			var ok bool
+			claims, ok = token.Claims.(jwt.MapClaims)
+			if !ok {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Недействительные данные токена"})
+				c.Abort()
+				return
+			}
+
+			id, idOk := claims["id"].(float64)
+			ver, versionOk := claims["ver"].(float64)
+			if !idOk || !versionOk {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Недействительные данные токена"})
+				c.Abort()
+				return
+			}
+			userID = int64(id)
+			version = int(ver)
+
+			// Токены, выданные при входе, привязаны к сессии
+			if sid, ok := claims["sid"].(float64); ok {
+				active, err := states.SessionActive(int64(sid))
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+					c.Abort()
+					return
+				}
+				if !active {
+					c.JSON(http.StatusUnauthorized, gin.H{"error": "Сессия завершена"})
+					c.Abort()
+					return
+				}
+				sessionID = int64(sid)
+			}
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return auth.JwtKey, nil
-		})
+		// Сверяем токен с текущим состоянием учетной записи
+		state, err := states.Get(userID)
+		if err != nil {
+			if err == auth.ErrUserNotFound {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Пользователь не найден"})
+				c.Abort()
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+			c.Abort()
+			return
+		}
 
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Недействительный токен"})
+		if state.IsBlocked {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Аккаунт заблокирован"})
 			c.Abort()
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Недействительные данные токена"})
+		// Версия проверяется только у JWT: API-ключи отзываются отдельно
+		if apiKey == nil && version != state.TokenVersion {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Токен отозван"})
 			c.Abort()
 			return
 		}
 
-		userRole := models.Role(claims["role"].(string))
-		userID := int64(claims["id"].(float64))
+		// Роль берем из БД, а не из токена, чтобы понижение прав действовало сразу
+		userRole := state.Role
 
-		// Проверяем роль пользователя
-		roleAllowed := false
+		// Проверяем роль пользователя, пустой список означает любую роль
+		roleAllowed := len(allowedRoles) == 0
 		for _, role := range allowedRoles {
 			if userRole == role {
 				roleAllowed = true
@@ -62,6 +161,150 @@ func AuthRequired(allowedRoles ...models.Role) gin.HandlerFunc {
 		// Сохраняем данные пользователя в контексте
 		c.Set("userID", userID)
 		c.Set("userRole", userRole)
+		if apiKey != nil {
+			c.Set("apiKey", apiKey)
+		}
+		if sessionID != 0 {
+			c.Set("sessionID", sessionID)
+		}
+
+		// Токен имперсонации: проверяем действующего администратора и журналируем запрос
+		if _, ok := claims["act"]; ok {
+			actorID, sessionID, ok := impersonationClaims(claims)
+			if !ok {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Недействительные данные токена"})
+				c.Abort()
+				return
+			}
+
+			// Право проверяется на каждом запросе: после его снятия с роли токен перестает действовать
+			actor, err := states.Get(actorID)
+			if err != nil || actor.IsBlocked {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Токен имперсонации больше не действителен"})
+				c.Abort()
+				return
+			}
+			allowed, err := states.HasPermission(actor.Role, models.PermissionImpersonate)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+				c.Abort()
+				return
+			}
+			if !allowed {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Токен имперсонации больше не действителен"})
+				c.Abort()
+				return
+			}
+
+			// Сессию имперсонации можно завершить досрочно, не затрагивая сессии пользователя
+			active, err := states.ImpersonationActive(sessionID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+				c.Abort()
+				return
+			}
+			if !active {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Сессия имперсонации завершена"})
+				c.Abort()
+				return
+			}
+
+			c.Set("impersonatorID", actorID)
+			c.Set("impersonationSessionID", sessionID)
+			c.Next()
+
+			logImpersonatedRequest(states, c, actorID, userID, sessionID)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func impersonationClaims(claims jwt.MapClaims) (int64, int64, bool) {
+	actor, actorOk := claims["act"].(float64)
+	session, sessionOk := claims["imp"].(float64)
+	return int64(actor), int64(session), actorOk && sessionOk
+}
+
+func logImpersonatedRequest(states *auth.UserStates, c *gin.Context, actorID, targetID, sessionID int64) {
+	status := c.Writer.Status()
+	log.Printf("Имперсонация: админ %d от имени пользователя %d: %s %s -> %d",
+		actorID, targetID, c.Request.Method, c.Request.URL.Path, status)
+
+	_, err := states.DB.Exec(
+		"INSERT INTO impersonation_requests (session_id, actor_id, target_id, method, path, status, ip) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		sessionID, actorID, targetID, c.Request.Method, c.Request.URL.Path, status, c.ClientIP())
+	if err != nil {
+		log.Printf("Ошибка записи журнала имперсонации: %v", err)
+	}
+}
+
+// InteractiveOnly запрещает действие при входе от имени другого пользователя
+// и при доступе по API-ключу
+func InteractiveOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, impersonating := c.Get("impersonatorID"); impersonating {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Действие недоступно в режиме входа от имени пользователя"})
+			c.Abort()
+			return
+		}
+		if _, viaAPIKey := c.Get("apiKey"); viaAPIKey {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Действие недоступно при доступе по API-ключу"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireTwoFactor требует подключенной двухфакторной аутентификации для ролей,
+// указанных в политике. Используется после AuthRequired.
+func RequireTwoFactor(states *auth.UserStates, policy auth.TwoFactorPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		state, err := states.Get(c.GetInt64("userID"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+			c.Abort()
+			return
+		}
+
+		if policy.Requires(state.Role) && !state.TOTPEnabled {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Подключите двухфакторную аутентификацию", "code": "two_factor_setup_required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// PermissionRequired пропускает запрос, только если роль пользователя имеет все
+// перечисленные права. Используется после AuthRequired.
+func PermissionRequired(states *auth.UserStates, permissions ...models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.MustGet("userRole").(models.Role)
+
+		for _, permission := range permissions {
+			allowed, err := states.HasPermission(role, permission)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+				c.Abort()
+				return
+			}
+
+			// API-ключ ограничен своими scopes в пределах прав владельца
+			if key, ok := c.Get("apiKey"); ok && !key.(*models.APIKey).HasScope(permission) {
+				allowed = false
+			}
+
+			if !allowed {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Недостаточно прав доступа"})
+				c.Abort()
+				return
+			}
+		}
+
 		c.Next()
 	}
 }
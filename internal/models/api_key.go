@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+type APIKey struct {
+	ID         int64       `db:"id" json:"id"`
+	Name       string      `db:"name" json:"name"`
+	Prefix     string      `db:"prefix" json:"prefix"`
+	KeyHash    string      `db:"key_hash" json:"-"`
+	Scopes     StringArray `db:"scopes" json:"scopes"`
+	UserID     int64       `db:"user_id" json:"user_id"`
+	ExpiresAt  *time.Time  `db:"expires_at" json:"expires_at"`
+	LastUsedAt *time.Time  `db:"last_used_at" json:"last_used_at"`
+	RevokedAt  *time.Time  `db:"revoked_at" json:"revoked_at"`
+	CreatedAt  time.Time   `db:"created_at" json:"created_at"`
+}
+
+// HasScope проверяет, разрешено ли ключу указанное право
+func (k *APIKey) HasScope(permission Permission) bool {
+	for _, scope := range k.Scopes {
+		if Permission(scope) == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+type Invitation struct {
+	ID             int64      `db:"id" json:"id"`
+	Email          string     `db:"email" json:"email"`
+	Role           Role       `db:"role" json:"role"`
+	InvitedBy      *int64     `db:"invited_by" json:"invited_by"`
+	InvitedByName  *string    `db:"invited_by_name" json:"invited_by_name"`
+	ExpiresAt      time.Time  `db:"expires_at" json:"expires_at"`
+	AcceptedAt     *time.Time `db:"accepted_at" json:"accepted_at"`
+	AcceptedUserID *int64     `db:"accepted_user_id" json:"accepted_user_id"`
+	RevokedAt      *time.Time `db:"revoked_at" json:"revoked_at"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+}
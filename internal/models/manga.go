@@ -54,3 +54,12 @@ type Manga struct {
 	CreatedAt   string      `db:"created_at" json:"created_at"`
 	UpdatedAt   string      `db:"updated_at" json:"updated_at"`
 }
+
+// MangaSearchHit - манга в результатах полнотекстового поиска.
+// TitleHighlight и Snippet содержат совпадения в тегах <mark>, остальной текст не экранирован.
+type MangaSearchHit struct {
+	Manga
+	Rank           float64 `db:"rank" json:"rank"`
+	TitleHighlight string  `db:"title_highlight" json:"title_highlight"`
+	Snippet        string  `db:"snippet" json:"snippet"`
+}
@@ -0,0 +1,50 @@
+package models
+
+type Permission string
+
+const (
+	// PermissionAll дает все права, включая добавленные позже
+	PermissionAll Permission = "*"
+
+	PermissionMangaWrite     Permission = "manga.write"
+	PermissionUsersRead      Permission = "users.read"
+	PermissionUsersBlock     Permission = "users.block"
+	PermissionUsersDelete    Permission = "users.delete"
+	PermissionLockoutsManage Permission = "lockouts.manage"
+	PermissionAPIKeysManage  Permission = "api_keys.manage"
+	PermissionInvitesManage  Permission = "invitations.manage"
+	PermissionImpersonate    Permission = "users.impersonate"
+)
+
+// Permissions - каталог прав, которые можно назначить роли
+var Permissions = map[Permission]string{
+	PermissionAll:            "Все права",
+	PermissionMangaWrite:     "Создание, изменение и удаление манги",
+	PermissionUsersRead:      "Просмотр списка пользователей",
+	PermissionUsersBlock:     "Блокировка пользователей",
+	PermissionUsersDelete:    "Удаление пользователей",
+	PermissionLockoutsManage: "Просмотр и снятие блокировок входа",
+	PermissionAPIKeysManage:  "Управление API-ключами",
+	PermissionInvitesManage:  "Приглашение сотрудников",
+	PermissionImpersonate:    "Вход от имени пользователя",
+}
+
+type RoleInfo struct {
+	Name        Role         `db:"name" json:"name"`
+	Description string       `db:"description" json:"description"`
+	IsSystem    bool         `db:"is_system" json:"is_system"`
+	Permissions []Permission `db:"-" json:"permissions"`
+	CreatedAt   string       `db:"created_at" json:"created_at"`
+	UpdatedAt   string       `db:"updated_at" json:"updated_at"`
+}
+
+type RoleChange struct {
+	ID        int64  `db:"id" json:"id"`
+	UserID    int64  `db:"user_id" json:"user_id"`
+	Username  string `db:"username" json:"username"`
+	OldRole   Role   `db:"old_role" json:"old_role"`
+	NewRole   Role   `db:"new_role" json:"new_role"`
+	ChangedBy *int64 `db:"changed_by" json:"changed_by"`
+	Reason    string `db:"reason" json:"reason"`
+	CreatedAt string `db:"created_at" json:"created_at"`
+}
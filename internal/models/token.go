@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type RefreshToken struct {
+	ID         int64      `db:"id" json:"id"`
+	UserID     int64      `db:"user_id" json:"user_id"`
+	TokenHash  string     `db:"token_hash" json:"-"`
+	FamilyID   string     `db:"family_id" json:"family_id"`
+	ExpiresAt  time.Time  `db:"expires_at" json:"expires_at"`
+	RevokedAt  *time.Time `db:"revoked_at" json:"revoked_at"`
+	ReplacedBy *int64     `db:"replaced_by" json:"replaced_by"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+}
@@ -1,5 +1,13 @@
 package models
 
+import "time"
+
+// BlockedSQL - действующий флаг блокировки с учетом срока временной блокировки
+const BlockedSQL = "(is_blocked AND (blocked_until IS NULL OR blocked_until > NOW()))"
+
+// IsBlockedSQL - BlockedSQL для списка выбираемых колонок
+const IsBlockedSQL = BlockedSQL + " AS is_blocked"
+
 type Role string
 
 const (
@@ -9,12 +17,30 @@ const (
 )
 
 type User struct {
-	ID        int64  `db:"id" json:"id"`
-	Username  string `db:"username" json:"username"`
-	Email     string `db:"email" json:"email"`
-	Password  string `db:"password" json:"-"`
-	Role      Role   `db:"role" json:"role"`
-	IsBlocked bool   `db:"is_blocked" json:"is_blocked"`
-	CreatedAt string `db:"created_at" json:"created_at"`
-	UpdatedAt string `db:"updated_at" json:"updated_at"`
+	ID            int64      `db:"id" json:"id"`
+	Username      string     `db:"username" json:"username"`
+	Email         string     `db:"email" json:"email"`
+	Password      string     `db:"password" json:"-"`
+	Role          Role       `db:"role" json:"role"`
+	IsBlocked     bool       `db:"is_blocked" json:"is_blocked"`
+	BlockedReason *string    `db:"blocked_reason" json:"blocked_reason,omitempty"`
+	BlockedUntil  *time.Time `db:"blocked_until" json:"blocked_until,omitempty"`
+	EmailVerified bool       `db:"email_verified" json:"email_verified"`
+	TOTPEnabled   bool       `db:"totp_enabled" json:"totp_enabled"`
+	DisplayName   *string    `db:"display_name" json:"display_name,omitempty"`
+	Bio           *string    `db:"bio" json:"bio,omitempty"`
+	AvatarURL     *string    `db:"avatar_url" json:"avatar_url,omitempty"`
+	TokenVersion  int        `db:"token_version" json:"-"`
+	DeletedAt     *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
+	CreatedAt     string     `db:"created_at" json:"created_at"`
+	UpdatedAt     string     `db:"updated_at" json:"updated_at"`
+}
+
+// PublicProfile - данные пользователя, видимые всем
+type PublicProfile struct {
+	Username    string  `db:"username" json:"username"`
+	DisplayName *string `db:"display_name" json:"display_name"`
+	Bio         *string `db:"bio" json:"bio"`
+	AvatarURL   *string `db:"avatar_url" json:"avatar_url"`
+	CreatedAt   string  `db:"created_at" json:"created_at"`
 }
@@ -0,0 +1,275 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Provider - внешний OpenID Connect провайдер (authorization code + PKCE)
+type Provider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	client *http.Client
+
+	// mu защищает только кеш; запросы к провайдеру выполняются без блокировки,
+	// чтобы медленный провайдер не останавливал все входы через него
+	mu            sync.Mutex
+	discovery     *discoveryDocument
+	discoveredAt  time.Time
+	jwks          *keySet
+	jwksRequested time.Time
+}
+
+// Документ discovery перечитывается раз в час, чтобы подхватывать смену эндпоинтов
+const discoveryTTL = time.Hour
+
+// Новый kid ищется в JWKS не чаще раза в минуту, чтобы нельзя было заставить сервер
+// постоянно ходить к провайдеру
+const jwksRefreshInterval = time.Minute
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims - данные пользователя из ID-токена
+type Claims struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	Nonce             string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+func NewProvider(name, issuer, clientID, clientSecret, redirectURL string, scopes []string) *Provider {
+	return &Provider{
+		Name:         name,
+		Issuer:       strings.TrimRight(issuer, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// CodeChallenge вычисляет PKCE code_challenge (S256) для code_verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthURL возвращает адрес страницы входа провайдера
+func (p *Provider) AuthURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.ClientID)
+	params.Set("redirect_uri", p.RedirectURL)
+	params.Set("scope", strings.Join(p.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", CodeChallenge(verifier))
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return doc.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange обменивает код авторизации на ID-токен и проверяет его
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("code_verifier", verifier)
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("ответ token endpoint: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || token.Error != "" {
+		return nil, fmt.Errorf("token endpoint: %s %s", token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("провайдер не вернул id_token")
+	}
+
+	return p.verifyIDToken(ctx, token.IDToken, nonce)
+}
+
+func (p *Provider) verifyIDToken(ctx context.Context, raw, nonce string) (*Claims, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{}
+	_, err = jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, doc.JWKSURI, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+		jwt.WithIssuer(doc.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("проверка id_token: %w", err)
+	}
+
+	if claims.Nonce != nonce {
+		return nil, errors.New("проверка id_token: nonce не совпадает")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("проверка id_token: пустой sub")
+	}
+
+	return claims, nil
+}
+
+func (p *Provider) discover(ctx context.Context) (*discoveryDocument, error) {
+	p.mu.Lock()
+	cached := p.discovery
+	fresh := cached != nil && time.Since(p.discoveredAt) < discoveryTTL
+	p.mu.Unlock()
+
+	if fresh {
+		return cached, nil
+	}
+
+	doc, err := p.fetchDiscovery(ctx)
+	if err != nil {
+		// Провайдер временно недоступен - продолжаем с прежним документом
+		if cached != nil {
+			return cached, nil
+		}
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.discovery = doc
+	p.discoveredAt = time.Now()
+	p.mu.Unlock()
+	return doc, nil
+}
+
+func (p *Provider) fetchDiscovery(ctx context.Context) (*discoveryDocument, error) {
+	var doc discoveryDocument
+	if err := p.getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, fmt.Errorf("discovery %s: %w", p.Name, err)
+	}
+	if strings.TrimRight(doc.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("discovery %s: issuer %q не совпадает с настроенным", p.Name, doc.Issuer)
+	}
+	return &doc, nil
+}
+
+// key возвращает ключ проверки по kid, перечитывая JWKS при появлении нового kid
+func (p *Provider) key(ctx context.Context, jwksURI, kid string) (interface{}, error) {
+	p.mu.Lock()
+	if p.jwks != nil {
+		if key, ok := p.jwks.find(kid); ok {
+			p.mu.Unlock()
+			return key, nil
+		}
+		// Время запроса отмечается до его отправки: параллельные входы с неизвестным kid
+		// не должны порождать по запросу к провайдеру каждый
+		if time.Since(p.jwksRequested) < jwksRefreshInterval {
+			p.mu.Unlock()
+			return nil, fmt.Errorf("неизвестный kid %q", kid)
+		}
+	}
+	p.jwksRequested = time.Now()
+	p.mu.Unlock()
+
+	var doc jwksDocument
+	if err := p.getJSON(ctx, jwksURI, &doc); err != nil {
+		return nil, fmt.Errorf("jwks %s: %w", p.Name, err)
+	}
+
+	keys, err := doc.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.jwks = keys
+	p.mu.Unlock()
+
+	if key, ok := keys.find(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("неизвестный kid %q", kid)
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
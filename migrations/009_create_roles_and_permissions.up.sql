@@ -0,0 +1,33 @@
+CREATE TABLE roles (
+    name VARCHAR(50) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    is_system BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE role_permissions (
+    role VARCHAR(50) NOT NULL REFERENCES roles(name) ON DELETE CASCADE ON UPDATE CASCADE,
+    permission VARCHAR(100) NOT NULL,
+    PRIMARY KEY (role, permission)
+);
+
+INSERT INTO roles (name, description, is_system) VALUES
+    ('super_admin', 'Суперадминистратор', TRUE),
+    ('admin', 'Администратор', TRUE),
+    ('user', 'Пользователь', TRUE);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('super_admin', '*'),
+    ('admin', 'manga.write'),
+    ('admin', 'users.read'),
+    ('admin', 'users.block'),
+    ('admin', 'users.delete'),
+    ('admin', 'lockouts.manage');
+
+-- Роль пользователя теперь ссылается на таблицу ролей вместо перечисления
+ALTER TABLE users ALTER COLUMN role DROP DEFAULT;
+ALTER TABLE users ALTER COLUMN role TYPE VARCHAR(50) USING role::text;
+ALTER TABLE users ALTER COLUMN role SET DEFAULT 'user';
+ALTER TABLE users ADD CONSTRAINT fk_users_role FOREIGN KEY (role) REFERENCES roles(name) ON UPDATE CASCADE;
+DROP TYPE user_role;
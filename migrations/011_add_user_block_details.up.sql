@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN blocked_reason TEXT;
+ALTER TABLE users ADD COLUMN blocked_until TIMESTAMP;
+ALTER TABLE users ADD COLUMN blocked_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN blocked_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
@@ -0,0 +1,22 @@
+CREATE TABLE impersonation_sessions (
+    id SERIAL PRIMARY KEY,
+    actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    target_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE impersonation_requests (
+    id SERIAL PRIMARY KEY,
+    session_id INTEGER NOT NULL REFERENCES impersonation_sessions(id) ON DELETE CASCADE,
+    actor_id INTEGER,
+    target_id INTEGER,
+    method VARCHAR(10) NOT NULL,
+    path TEXT NOT NULL,
+    status INTEGER NOT NULL,
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_impersonation_requests_session ON impersonation_requests(session_id);
@@ -0,0 +1,24 @@
+-- Таблица и право для роли admin создаются один раз: миграции выполняются при каждом запуске,
+-- и снятое суперадмином право не должно возвращаться после деплоя
+DO $$
+BEGIN
+    IF to_regclass('api_keys') IS NULL THEN
+        CREATE TABLE api_keys (
+            id SERIAL PRIMARY KEY,
+            name VARCHAR(100) NOT NULL,
+            prefix VARCHAR(16) UNIQUE NOT NULL,
+            key_hash VARCHAR(64) UNIQUE NOT NULL,
+            scopes JSONB NOT NULL DEFAULT '[]',
+            user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            expires_at TIMESTAMP,
+            last_used_at TIMESTAMP,
+            revoked_at TIMESTAMP,
+            created_at TIMESTAMP NOT NULL DEFAULT NOW()
+        );
+
+        CREATE INDEX idx_api_keys_user ON api_keys(user_id);
+
+        INSERT INTO role_permissions (role, permission) VALUES ('admin', 'api_keys.manage') ON CONFLICT DO NOTHING;
+    END IF;
+END
+$$;
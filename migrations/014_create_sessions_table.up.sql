@@ -0,0 +1,19 @@
+CREATE TABLE sessions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    family_id VARCHAR(64) UNIQUE NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX idx_sessions_user ON sessions(user_id);
+
+-- Сессии для уже выданных refresh-токенов
+INSERT INTO sessions (user_id, family_id, expires_at)
+SELECT user_id, family_id, MAX(expires_at) FROM refresh_tokens
+WHERE revoked_at IS NULL
+GROUP BY user_id, family_id;
@@ -0,0 +1,7 @@
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN deleted_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_users_deleted_at ON users(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Обезличенные аккаунты считаются удаленными
+UPDATE users SET deleted_at = anonymized_at WHERE anonymized_at IS NOT NULL;
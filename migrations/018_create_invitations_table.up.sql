@@ -0,0 +1,24 @@
+-- Таблица и право для роли admin создаются один раз: миграции выполняются при каждом запуске,
+-- и снятое суперадмином право не должно возвращаться после деплоя
+DO $$
+BEGIN
+    IF to_regclass('invitations') IS NULL THEN
+        CREATE TABLE invitations (
+            id SERIAL PRIMARY KEY,
+            email VARCHAR(100) NOT NULL,
+            role VARCHAR(50) NOT NULL REFERENCES roles(name) ON UPDATE CASCADE ON DELETE CASCADE,
+            token_hash VARCHAR(64) UNIQUE NOT NULL,
+            invited_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+            expires_at TIMESTAMP NOT NULL,
+            accepted_at TIMESTAMP,
+            accepted_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+            revoked_at TIMESTAMP,
+            created_at TIMESTAMP NOT NULL DEFAULT NOW()
+        );
+
+        CREATE INDEX idx_invitations_email ON invitations(email);
+
+        INSERT INTO role_permissions (role, permission) VALUES ('admin', 'invitations.manage') ON CONFLICT DO NOTHING;
+    END IF;
+END
+$$;
@@ -0,0 +1,31 @@
+ALTER TABLE manga ADD COLUMN IF NOT EXISTS search_vector tsvector;
+
+-- Название и описание индексируются в русской и английской конфигурациях,
+-- имена авторов и художников - без стемминга, жанры - со стеммингом
+CREATE OR REPLACE FUNCTION manga_search_vector_update() RETURNS trigger AS $$
+DECLARE
+    genres_text TEXT;
+BEGIN
+    SELECT string_agg(value, ' ') INTO genres_text FROM jsonb_array_elements_text(COALESCE(NEW.genres, '[]'::jsonb));
+
+    NEW.search_vector :=
+        setweight(to_tsvector('russian', COALESCE(NEW.title, '')), 'A') ||
+        setweight(to_tsvector('english', COALESCE(NEW.title, '')), 'A') ||
+        setweight(to_tsvector('simple', COALESCE(NEW.author, '') || ' ' || COALESCE(NEW.artist, '')), 'B') ||
+        setweight(to_tsvector('russian', COALESCE(genres_text, '')), 'C') ||
+        setweight(to_tsvector('english', COALESCE(genres_text, '')), 'C') ||
+        setweight(to_tsvector('russian', COALESCE(NEW.description, '')), 'D') ||
+        setweight(to_tsvector('english', COALESCE(NEW.description, '')), 'D');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS manga_search_vector_trigger ON manga;
+CREATE TRIGGER manga_search_vector_trigger
+    BEFORE INSERT OR UPDATE OF title, description, author, artist, genres ON manga
+    FOR EACH ROW EXECUTE FUNCTION manga_search_vector_update();
+
+-- Заполняем вектор только там, где его еще нет: миграции выполняются при каждом запуске
+UPDATE manga SET title = title WHERE search_vector IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_manga_search_vector ON manga USING GIN(search_vector);
@@ -0,0 +1,5 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Нечеткий поиск по названию и автору (операторы %, <% и ILIKE)
+CREATE INDEX IF NOT EXISTS idx_manga_title_trgm ON manga USING GIN(title gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_manga_author_trgm ON manga USING GIN(author gin_trgm_ops);
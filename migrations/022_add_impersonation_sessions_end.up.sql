@@ -0,0 +1,2 @@
+ALTER TABLE impersonation_sessions ADD COLUMN IF NOT EXISTS ended_at TIMESTAMP;
+ALTER TABLE impersonation_sessions ADD COLUMN IF NOT EXISTS ended_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
@@ -0,0 +1,2 @@
+-- Тела отправленных писем содержат ссылки сброса пароля и подтверждения email, храним их только до отправки
+UPDATE email_outbox SET body = '' WHERE status IN ('sent', 'failed') AND body <> '';
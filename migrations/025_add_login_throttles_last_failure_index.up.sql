@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_login_throttles_last_failure ON login_throttles(last_failure_at);